@@ -0,0 +1,351 @@
+package hrm
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+/* A program is a compiled chunk of instructions, ready to be run. Size is
+the number of instructions, as counted by the game. Definitions holds the
+DEFINE blocks of the program, Comments its COMMENT instructions, and
+Tiles the number of each named tile. */
+type Program struct {
+	chunk *Chunk
+	closures []closure
+	Size int
+	Definitions []Definition
+	Comments []Comment
+	Tiles map[string]int
+}
+
+/* The inbox holds the values given to a program, in order. */
+type Inbox []Value
+
+/* The floor holds the tiles a program can use, indexed by address. */
+type Floor []Value
+
+/* The largest floor in the game has 25 tiles, a 5 by 5 grid. */
+const MAX_FLOOR = 25
+
+/* The result of running a program to completion. */
+type Result struct {
+	Outbox []Value
+	Floor Floor
+	Steps int
+}
+
+/* Compiles source code into a program. If any diagnostics are returned,
+the program is nil. */
+func Compile(source string) (*Program, []Diagnostic) {
+	var chunk Chunk
+	chunk.Init()
+	parser := parse(source, &chunk)
+	if len(parser.diagnostics) > 0 {
+		return nil, parser.diagnostics
+	}
+	return &Program{&chunk, bindClosures(&chunk), parser.size, parser.definitions, parser.comments, parser.tiles}, nil
+}
+
+/* Runs a program against an inbox and floor. The floor is copied, so
+the caller's tiles are left untouched. A *RuntimeError is returned if
+the program fails, along with the result up to that point. */
+func Run(program *Program, inbox Inbox, floor Floor) (Result, error) {
+	return execute(program, inbox, floor, TestConfig{})
+}
+
+/* Runs a program on the configured backend, stepping and tracing the VM
+as configured. */
+func execute(program *Program, inbox Inbox, floor Floor, config TestConfig) (Result, error) {
+	outbox := make([]Value, 0)
+	registers := append(Floor{}, floor...)
+	var vm VM
+	vm.Init(config.Debug, inbox, &outbox, registers)
+	vm.SetStepMode(config.StepMode)
+	switch config.Backend {
+	case BACKEND_CLOSURE:
+		vm.executeClosures(program.chunk, program.closures)
+	default:
+		vm.Execute(program.chunk)
+	}
+	result := Result{outbox, registers, vm.steps}
+	if vm.err != nil {
+		return result, vm.err
+	}
+	return result, nil
+}
+
+/* A run report records a single run of a program against a level. A run
+is made of independent test cases, which are counted along with the
+values in their inboxes and expected outboxes. Steps is the total of the
+cases checked, each counted from zero. A random run is a single case, so
+its Steps are those of the game, or of LevelRun's inbox, but the Steps of
+an exhaustive run are not. Failures lists the cases which failed, and Err
+is the error of the first. */
+type RunReport struct {
+	Cases int
+	InboxValues int
+	ExpectedValues int
+	Steps int
+	Err error
+	Failures []CaseFailure
+}
+
+/* A case failure records a test case which failed, by its index within
+its run, with its inbox, expected outbox and actual outbox. */
+type CaseFailure struct {
+	Case int
+	Inbox []Value
+	Expected []Value
+	Outbox []Value
+	Err error
+}
+
+/* A report records how a program did when checked against a level. */
+type Report struct {
+	Level int
+	Size int
+	SizeGoal int
+	SpeedGoal int
+	Seed int64
+	Runs []RunReport
+}
+
+/* Returns the average number of steps over all runs. */
+func (r Report) AverageSteps() float64 {
+	if len(r.Runs) == 0 {
+		return 0
+	}
+	total := 0
+	for _, run := range r.Runs {
+		total += run.Steps
+	}
+	return float64(total) / float64(len(r.Runs))
+}
+
+/* Checks a program against a level's exhaustive inputs. The error is nil
+if the program passed, otherwise it is the error which failed the check. */
+func Check(level int, program *Program) (Report, error) {
+	return CheckWith(level, program, TestConfig{})
+}
+
+/* Checks a program against a level, as configured. */
+func CheckWith(level int, program *Program, config TestConfig) (Report, error) {
+	return CheckContext(context.Background(), level, program, config)
+}
+
+/* Checks a program against a level, as configured, until ctx is done.
+The level's test cases are generated as they are needed and checked in
+parallel, so that no run is ever held in memory. Unless config.AllFailures
+is set, checking stops at the first case which fails, with the report
+ending at its run. If ctx is done before the check is, the report ends at
+the first case which was not checked, and the error is ctx's. */
+func CheckContext(ctx context.Context, level int, program *Program, config TestConfig) (Report, error) {
+	report := Report{Level: level, Size: program.Size, Seed: config.Seed}
+	test, ok := Level[level]
+	if !ok {
+		return report, &LevelError{level, ERR_UNKNOWN_LEVEL}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan caseJob)
+	var goal INFO
+	go generateCases(ctx, test, config, jobs, &goal)
+	results := checkCases(ctx, cancel, program, jobs, config)
+	// Results arrive out of order, so they are held until those before
+	// them have been reported
+	pending := make(map[int]caseResult)
+	next := 0
+	var err error
+	stopped := false
+	for result := range results {
+		pending[result.seq] = result
+		for !stopped {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next += 1
+			for len(report.Runs) <= result.run {
+				report.Runs = append(report.Runs, RunReport{})
+			}
+			run := &report.Runs[result.run]
+			run.Cases += 1
+			run.InboxValues += len(result.inbox)
+			run.ExpectedValues += len(result.expected)
+			run.Steps += result.Steps
+			if result.err == nil {
+				continue
+			}
+			run.Failures = append(run.Failures, CaseFailure{
+				result.index, result.inbox, result.expected, result.Outbox, result.err,
+			})
+			if run.Err == nil {
+				run.Err = result.err
+			}
+			if err == nil {
+				err = result.err
+			}
+			stopped = !config.AllFailures
+		}
+	}
+	// The results are closed once every case has been generated
+	report.SizeGoal = goal.size
+	report.SpeedGoal = goal.steps
+	if err == nil && ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+	return report, err
+}
+
+/* A case job is a test case to check, numbered by seq in the order cases
+were generated, with its run, index within the run, and floor. */
+type caseJob struct {
+	seq int
+	run int
+	index int
+	floor Floor
+	testCase
+}
+
+/* The result of checking a case job. */
+type caseResult struct {
+	caseJob
+	Result
+	err error
+}
+
+/* Generates the test cases of every run of a level in order, sending
+them as jobs until ctx is done. Random runs are generated in turn, so
+that their inboxes follow the seed. Closes jobs once done. */
+func generateCases(ctx context.Context, test levelFn, config TestConfig, jobs chan<- caseJob, goal *INFO) {
+	defer close(jobs)
+	var rng *rand.Rand
+	runs := 1
+	if config.Runs > 0 {
+		rng = rand.New(rand.NewSource(config.Seed))
+		runs = config.Runs
+	}
+	seq := 0
+	for i := 0; i < runs && ctx.Err() == nil; i += 1 {
+		registers := make([]Value, 0)
+		index := 0
+		send := func(c testCase) bool {
+			select {
+			case jobs <- caseJob{seq, i, index, registers, c}:
+				seq += 1
+				index += 1
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		test(data{send, &registers, goal, rng})
+	}
+}
+
+/* Checks case jobs on a pool of goroutines, which share the compiled
+program and run each case on a fresh copy of its floor. Unless
+config.AllFailures is set, a failing case cancels the jobs not yet handed
+out. Jobs are handed out in order, so every job before a failure is still
+checked. The results are closed once every job has been checked. */
+func checkCases(ctx context.Context, cancel context.CancelFunc, program *Program, jobs <-chan caseJob, config TestConfig) <-chan caseResult {
+	results := make(chan caseResult, config.workers())
+	var wg sync.WaitGroup
+	for w := config.workers(); w > 0; w -= 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result, err := execute(program, job.inbox, job.floor, config)
+				if err == nil {
+					err = compareOutbox(job.expected, result.Outbox)
+				}
+				if err != nil && !config.AllFailures {
+					cancel()
+				}
+				results <- caseResult{job, result, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+/* Asserts that all outbox values are expected. */
+func compareOutbox(expected, outbox []Value) error {
+	if len(expected) < len(outbox) {
+		return &OutboxError{
+			Index: len(expected),
+			Actual: outbox[len(expected)],
+			Kind: ERR_TOO_MANY_OUTPUTS,
+			Message: "Too many values in OUTBOX.",
+		}
+	}
+	if len(expected) > len(outbox) {
+		return &OutboxError{
+			Index: len(outbox),
+			Expected: expected[len(outbox)],
+			Kind: ERR_TOO_FEW_OUTPUTS,
+			Message: fmt.Sprintf("Not enough stuff in the OUTBOX! " +
+				"Management expected a total of %d items, not %d!",
+				len(expected), len(outbox)),
+		}
+	}
+	for i, expVal := range expected {
+		if outVal := outbox[i]; expVal != outVal {
+			return &OutboxError{
+				Index: i,
+				Expected: expVal,
+				Actual: outVal,
+				Kind: ERR_BAD_OUTBOX,
+				Message: fmt.Sprintf("Bad outbox! Management expected %v, " +
+					"but you outboxed %v.", expVal, outVal),
+			}
+		}
+	}
+	return nil
+}
+
+/* Returns the floor a level starts with. */
+func LevelFloor(level int) (Floor, error) {
+	_, _, floor, err := LevelRun(level, nil)
+	return floor, err
+}
+
+/* Returns the inbox, expected outbox and floor for one run of a level.
+The level's exhaustive inputs are used if rng is nil, otherwise the inbox
+is random like the game's. The level's test cases are all generated and
+joined into a single inbox, to be run on one floor. */
+func LevelRun(level int, rng *rand.Rand) (Inbox, []Value, Floor, error) {
+	test, ok := Level[level]
+	if !ok {
+		return nil, nil, nil, &LevelError{level, ERR_UNKNOWN_LEVEL}
+	}
+	cases, registers, _ := levelCases(test, rng)
+	inbox := make([]Value, 0)
+	expected := make([]Value, 0)
+	for _, c := range cases {
+		inbox = append(inbox, c.inbox...)
+		expected = append(expected, c.expected...)
+	}
+	return inbox, expected, registers, nil
+}
+
+/* Returns the test cases, floor and goals of one run of a level. */
+func levelCases(test levelFn, rng *rand.Rand) ([]testCase, Floor, INFO) {
+	cases := make([]testCase, 0)
+	registers := make([]Value, 0)
+	goal := INFO{}
+	add := func(c testCase) bool {
+		cases = append(cases, c)
+		return true
+	}
+	test(data{add, &registers, &goal, rng})
+	return cases, registers, goal
+}
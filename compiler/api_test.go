@@ -0,0 +1,42 @@
+package hrm
+
+import (
+	"testing"
+)
+
+func TestRuntimeErrorLocation(t *testing.T) {
+	program := compileTest(t, "    INBOX\n    OUTBOX\n  a: ADD 3\n")
+	_, err := Run(program, Inbox{IntVal(1)}, make(Floor, 4))
+	e, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a runtime error, got %v.", err)
+	}
+	if e.Line != 3 || e.Column != 6 || e.Tile != 3 || e.Instruction != "ADD" || e.Kind != ERR_EMPTY_TILE {
+		t.Errorf("Expected an empty tile at ADD 3 on line 3, column 6, got %+v.", *e)
+	}
+}
+
+/* Floors on which COPYFROM [1], on line 2, cannot find its tile. */
+var BAD_POINTERS = []struct {
+	name string
+	floor Floor
+	kind ErrorKind
+}{
+	{"Letter", Floor{IntVal(0), CharVal('A'), EmptyVal()}, ERR_BAD_POINTER},
+	{"Empty", Floor{IntVal(0), EmptyVal(), EmptyVal()}, ERR_EMPTY_TILE},
+	{"OffFloor", Floor{IntVal(0), IntVal(3), EmptyVal()}, ERR_BAD_ADDRESS},
+	{"Negative", Floor{IntVal(0), IntVal(-1), EmptyVal()}, ERR_BAD_ADDRESS},
+}
+
+func TestBadPointers(t *testing.T) {
+	program := compileTest(t, "    INBOX\n    COPYFROM [1]\n    OUTBOX\n")
+	for _, test := range BAD_POINTERS {
+		for _, backend := range []Backend{BACKEND_VM, BACKEND_CLOSURE} {
+			_, err := execute(program, Inbox{IntVal(1)}, test.floor, TestConfig{Backend: backend})
+			e, ok := err.(*RuntimeError)
+			if !ok || e.Kind != test.kind || e.Line != 2 || e.Tile != 1 {
+				t.Errorf("%s, %s: expected %v at tile 1 on line 2, got %v.", test.name, backend, test.kind, err)
+			}
+		}
+	}
+}
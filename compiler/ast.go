@@ -0,0 +1,132 @@
+package hrm
+
+import (
+	"strings"
+)
+
+/* A span locates a node in the source. It starts at Line and Column, and
+ends just before EndLine and EndColumn. */
+type Span struct {
+	Line int
+	Column int
+	EndLine int
+	EndColumn int
+}
+
+/* Returns the span of a token, which may cover several lines. */
+func tokenSpan(t Token) Span {
+	span := Span{t.line, t.column, t.line, t.column + len(t.Literal)}
+	switch t.Type {
+	case NEWLINE, EOF, ERROR:
+		span.EndColumn = t.column + 1
+	}
+	if n := strings.Count(t.Literal, "\n"); n > 0 {
+		span.EndLine += n
+		span.EndColumn = len(t.Literal) - strings.LastIndex(t.Literal, "\n")
+	}
+	return span
+}
+
+/* Returns the span from the start of a to the end of b. */
+func joinSpans(a, b Span) Span {
+	return Span{a.Line, a.Column, b.EndLine, b.EndColumn}
+}
+
+/* An enum of the kinds of nodes in a program. */
+type NodeType int
+const (
+	NODE_INSTRUCTION NodeType = iota
+	NODE_LABEL
+	NODE_COMMENT
+	NODE_TILE
+	NODE_DEFINE
+	NODE_REMARK
+	NODE_EXPRESSION
+)
+
+/* An enum of the kinds of instruction operands. */
+type OperandType int
+const (
+	OPERAND_NONE OperandType = iota
+	OPERAND_TILE
+	OPERAND_INDIRECT
+	OPERAND_LABEL
+)
+
+/* The operand of an instruction. Tile is the tile used, directly or
+through the tile it names. Name is the label jumped to, or the name the
+tile was given by, if any. */
+type Operand struct {
+	Type OperandType
+	Tile int
+	Name string
+	Span Span
+}
+
+/* A node is a single statement of a program. Which fields are used
+depends on the type of node:
+- An instruction has its opcode and operand.
+- A label, or a tile declaration, has the name it declares. Value is the
+number of a declared tile, and Text is set if the tile was declared by a
+"-- @tile" comment.
+- A comment has its number as Value, and its DEFINE COMMENT block.
+- A DEFINE block has its Definition.
+- A remark is a "--" comment, and has its Text.
+- An expression is a lone number, and has it as Value. */
+type Node struct {
+	Type NodeType
+	Op byte
+	Operand Operand
+	Name string
+	Value int
+	Text string
+	Definition *Definition
+	Span Span
+}
+
+/* An AST holds a program as data: its nodes in source order, and the
+DEFINE blocks it contains. End is the last line, where the program halts. */
+type Ast struct {
+	Nodes []Node
+	Definitions []Definition
+	End int
+}
+
+/* Parses source code into an AST. If any diagnostics are returned, the
+AST only holds the statements which were parsed without error. */
+func Parse(source string) (*Ast, []Diagnostic) {
+	parser := parseAst(source)
+	return parser.ast, parser.diagnostics
+}
+
+/* Lowers an AST to instructions in a chunk. Jumps may go forward, so
+they are patched once every label has an index. Lone numbers are not
+instructions of the game, so they are dropped. Returns the index of each
+label. */
+func (a *Ast) lower(chunk *Chunk) map[string]int {
+	labels := map[string]int{}
+	jumps := map[int]string{}
+	for _, node := range a.Nodes {
+		switch node.Type {
+		case NODE_LABEL:
+			if _, ok := labels[node.Name]; !ok {
+				labels[node.Name] = len(chunk.code)
+			}
+		case NODE_INSTRUCTION:
+			in := instruction{op: node.Op, tile: -1, target: -1, line: node.Span.Line, column: node.Span.Column}
+			switch node.Operand.Type {
+			case OPERAND_TILE, OPERAND_INDIRECT:
+				in.tile = node.Operand.Tile
+				in.indirect = node.Operand.Type == OPERAND_INDIRECT
+			case OPERAND_LABEL:
+				jumps[len(chunk.code)] = node.Operand.Name
+			}
+			chunk.Write(in)
+		}
+	}
+	chunk.Write(instruction{op: OP_HALT, tile: -1, target: -1, line: a.End})
+	for i, label := range jumps {
+		chunk.code[i].target = labels[label]
+	}
+	return labels
+}
@@ -0,0 +1,53 @@
+package hrm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	source := "-- sum --\n" +
+		"TILE total = 2\n" +
+		"-- @tile 3 count\n" +
+		"a:\n" +
+		"    INBOX\n" +
+		"    COPYTO total\n" +
+		"    ADD [count] -- add\n" +
+		"\tJUMPZ a\n" +
+		"    COMMENT 1\n" +
+		"DEFINE COMMENT 1\n" +
+		DRAWING + ";\n"
+	ast, diagnostics := Parse(source)
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	drawing := &Definition{DEFINE_COMMENT, 1, "", DRAWING, DRAWING_POINTS, 10}
+	expected := []Node{
+		{Type: NODE_REMARK, Text: "-- sum --", Span: Span{1, 1, 1, 10}},
+		{Type: NODE_TILE, Name: "total", Value: 2, Span: Span{2, 1, 2, 15}},
+		{Type: NODE_TILE, Name: "count", Value: 3, Text: "-- @tile 3 count", Span: Span{3, 1, 3, 17}},
+		{Type: NODE_LABEL, Name: "a", Span: Span{4, 1, 4, 3}},
+		{Type: NODE_INSTRUCTION, Op: OP_INBOX, Span: Span{5, 5, 5, 10}},
+		{Type: NODE_INSTRUCTION, Op: OP_COPYTO, Operand: Operand{OPERAND_TILE, 2, "total", Span{6, 12, 6, 17}}, Span: Span{6, 5, 6, 17}},
+		{Type: NODE_INSTRUCTION, Op: OP_ADD, Operand: Operand{OPERAND_INDIRECT, 3, "count", Span{7, 9, 7, 16}}, Span: Span{7, 5, 7, 16}},
+		{Type: NODE_REMARK, Text: "-- add", Span: Span{7, 17, 7, 23}},
+		{Type: NODE_INSTRUCTION, Op: OP_JUMPZ, Operand: Operand{OPERAND_LABEL, 0, "a", Span{8, 8, 8, 9}}, Span: Span{8, 2, 8, 9}},
+		{Type: NODE_COMMENT, Value: 1, Definition: drawing, Span: Span{9, 5, 9, 14}},
+		// The block spans two lines, up to and including its ';'
+		{Type: NODE_DEFINE, Value: 1, Definition: drawing, Span: Span{10, 1, 11, 33}},
+	}
+	if len(ast.Nodes) != len(expected) {
+		t.Fatalf("Expected %d nodes, got %+v.", len(expected), ast.Nodes)
+	}
+	for i, node := range ast.Nodes {
+		if !reflect.DeepEqual(node, expected[i]) {
+			t.Errorf("Node %d: expected %+v, got %+v.", i, expected[i], node)
+		}
+	}
+	if !reflect.DeepEqual(ast.Definitions, []Definition{*drawing}) {
+		t.Errorf("Expected the definition %+v, got %+v.", *drawing, ast.Definitions)
+	}
+	if ast.End != 12 {
+		t.Errorf("Expected the program to end on line 12, got %d.", ast.End)
+	}
+}
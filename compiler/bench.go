@@ -0,0 +1,65 @@
+package hrm
+
+import (
+	"fmt"
+	"time"
+)
+
+/* A benchmark records how fast a program ran against a level. Runs is
+the number of times the level's exhaustive inbox was run on Backend, and
+Steps the steps taken over all runs. */
+type Benchmark struct {
+	Level int
+	Backend Backend
+	Runs int
+	Steps int
+	Elapsed time.Duration
+}
+
+/* Returns the number of steps run per second. */
+func (b Benchmark) StepsPerSecond() float64 {
+	if b.Elapsed <= 0 {
+		return 0
+	}
+	return float64(b.Steps) / b.Elapsed.Seconds()
+}
+
+/* Returns the average time taken by a step. */
+func (b Benchmark) TimePerStep() time.Duration {
+	if b.Steps == 0 {
+		return 0
+	}
+	return b.Elapsed / time.Duration(b.Steps)
+}
+
+func (b Benchmark) String() string {
+	return fmt.Sprintf("Level %d (%s): %d runs, %d steps in %v (%.1fM steps/s, %v/step)",
+		b.Level, b.Backend, b.Runs, b.Steps, b.Elapsed.Round(time.Millisecond),
+		b.StepsPerSecond() / 1e6, b.TimePerStep())
+}
+
+/* Runs a program against a level's exhaustive inbox over and over, for
+at least the given duration, on the configured backend. The program must
+pass the level, so that a broken program is not timed. */
+func Bench(level int, program *Program, duration time.Duration, config TestConfig) (Benchmark, error) {
+	bench := Benchmark{Level: level, Backend: config.Backend}
+	inbox, expected, floor, err := LevelRun(level, nil)
+	if err != nil {
+		return bench, err
+	}
+	result, err := execute(program, inbox, floor, config)
+	if err == nil {
+		err = compareOutbox(expected, result.Outbox)
+	}
+	if err != nil {
+		return bench, err
+	}
+	start := time.Now()
+	for bench.Elapsed < duration {
+		result, _ := execute(program, inbox, floor, config)
+		bench.Runs += 1
+		bench.Steps += result.Steps
+		bench.Elapsed = time.Since(start)
+	}
+	return bench, nil
+}
@@ -0,0 +1,48 @@
+package hrm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// The levels whose solutions are benchmarked, chosen for their long runs
+var BENCHMARK_LEVELS = []int{20, 21, 28, 41}
+
+/* Benchmarks the solutions of BENCHMARK_LEVELS on both backends, running
+each against its level's exhaustive inbox, as hrm bench does. Each op is
+one step, so ns/op is the time taken by a step. */
+func BenchmarkBackends(b *testing.B) {
+	for _, level := range BENCHMARK_LEVELS {
+		source, err := ioutil.ReadFile(fmt.Sprintf("../levels/%02d", level))
+		if err != nil {
+			b.Fatal(err)
+		}
+		program := compileTest(b, string(source))
+		inbox, expected, floor, err := LevelRun(level, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, backend := range []Backend{BACKEND_VM, BACKEND_CLOSURE} {
+			config := TestConfig{Backend: backend}
+			b.Run(fmt.Sprintf("Level%d/%s", level, backend), func(b *testing.B) {
+				result, err := execute(program, inbox, floor, config)
+				if err == nil {
+					err = compareOutbox(expected, result.Outbox)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				// Each run counts for its steps, so a run without any
+				// would never end the loop
+				if result.Steps == 0 {
+					b.Fatal("The solution runs no steps.")
+				}
+				b.ResetTimer()
+				for steps := 0; steps < b.N; steps += result.Steps {
+					result, _ = execute(program, inbox, floor, config)
+				}
+			})
+		}
+	}
+}
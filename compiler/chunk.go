@@ -2,108 +2,160 @@ package hrm
 
 import (
 	"fmt"
+	"io"
+	"strconv"
 )
 
-/* Slices in Go are dynamically resized. Internally,
-they have a length and capacity. When the new length
-would exceed the cap, memory is allocated to double
-the capacity. */
+/* A chunk holds a compiled program as a list of instructions, each with
+its operand inline, so the VM runs one instruction per dispatch. Jump
+targets are indices into the list, so there is no limit on the length of
+a program. */
 type Chunk struct {
-	count int
-	code []byte
-	constants []Value
-	lines []int
+	code []instruction
 }
 
-/* Initialize chunks with a capacity of 8 (OpCodes). */
-func (chunk *Chunk) Init() {
-	chunk.code = make([]byte, 0, 8)
-	chunk.lines = make([]int, 0, 8)
+/* A decoded instruction. Tile is the tile operand, or -1 if the
+instruction has none, and is the address of the tile to use if indirect.
+Target is the index of the instruction jumped to, or -1 if the
+instruction does not jump. Line and column locate the instruction in the
+source. */
+type instruction struct {
+	op byte
+	indirect bool
+	tile int
+	target int
+	line int
+	column int
 }
 
-/* Writes an OpCode to the chunk */
-func (chunk *Chunk) Write(data byte, line int) {
-	chunk.code = append(chunk.code, data)
-	chunk.lines = append(chunk.lines, line)
-	chunk.count += 1
+/* Initialize chunks with a capacity of 8 (instructions). */
+func (chunk *Chunk) Init() {
+	chunk.code = make([]instruction, 0, 8)
 }
 
-/* Adds a constant to the chunk constant pool.
-Returns its index in the constant pool. */
-func (chunk *Chunk) AddConst(data Value) int {
-	chunk.constants = append(chunk.constants, data)
-	return len(chunk.constants) - 1
+/* Writes an instruction to the chunk. Returns its index, which is where
+jumps to it land. */
+func (chunk *Chunk) Write(in instruction) int {
+	chunk.code = append(chunk.code, in)
+	return len(chunk.code) - 1
 }
 
 /* Inspect the chunk and its contents for debugging. */
-func (chunk *Chunk) Disassemble(name string) {
-	fmt.Printf("[%s]\n", name)
-	for offset := 0; offset < chunk.count; {
-		offset = DisassembleInstruction(chunk, offset)
+func (chunk *Chunk) Disassemble(w io.Writer, name string) {
+	fmt.Fprintf(w, "[%s]\n", name)
+	for offset := 0; offset < len(chunk.code); {
+		offset = DisassembleInstruction(w, chunk, offset)
 	}
 }
 
 /* Disassembles an instruction into a human readable format. */
-func DisassembleInstruction(chunk *Chunk, offset int) int {
-	fmt.Printf("%04d ", offset)
-	if offset > 0 && chunk.lines[offset] == chunk.lines[offset - 1] {
-		fmt.Printf("   | ")
+func DisassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	in := chunk.code[offset]
+	if offset > 0 && in.line == chunk.code[offset - 1].line {
+		fmt.Fprintf(w, "   | ")
 	} else {
-		fmt.Printf("%4d ", chunk.lines[offset])
+		fmt.Fprintf(w, "%4d ", in.line)
 	}
-	instruction := chunk.code[offset]
-	switch instruction {
+	name := mnemonic(in.op)
+	switch in.op {
+	case OP_HALT, OP_INBOX, OP_OUTBOX:
+		return simpleInstruction(w, name, offset)
+	case OP_JUMP, OP_JUMPZ, OP_JUMPN:
+		return jumpInstruction(w, name, in, offset)
+	case OP_COPYFROM, OP_COPYTO, OP_ADD, OP_SUB, OP_BUMPUP, OP_BUMPDN:
+		return tileInstruction(w, name, in, offset)
+	default:
+		fmt.Fprintf(w, "Unknown opcode %d.\n", in.op)
+		return offset + 1
+	}
+}
+
+/* Returns the mnemonic of an opcode, as disassembly and traces show it,
+or "" if the opcode is unknown. */
+func mnemonic(op byte) string {
+	switch op {
 	case OP_HALT:
-		return simpleInstruction("HALT", offset)
-	case OP_POP:
-		return simpleInstruction("POP", offset)
-	case OP_CONSTANT:
-		return constantInstruction("CONSTANT", chunk, offset)
+		return "HALT"
 	case OP_INBOX:
-		return simpleInstruction("INBOX", offset)
+		return "INBOX"
 	case OP_OUTBOX:
-		return simpleInstruction("OUTBOX", offset)
+		return "OUTBOX"
 	case OP_JUMP:
-		return byteInstruction("JUMP", chunk, offset)
+		return "JUMP"
 	case OP_JUMPZ:
-		return byteInstruction("JUMP IF ZERO", chunk, offset)
+		return "JUMP IF ZERO"
 	case OP_JUMPN:
-		return byteInstruction("JUMP IF NEGATIVE", chunk, offset)
+		return "JUMP IF NEGATIVE"
 	case OP_COPYFROM:
-		return byteInstruction("COPYFROM", chunk, offset)
+		return "COPYFROM"
 	case OP_COPYTO:
-		return byteInstruction("COPYTO", chunk, offset)
+		return "COPYTO"
 	case OP_ADD:
-		return byteInstruction("ADD", chunk, offset)
+		return "ADD"
+	case OP_SUB:
+		return "SUB"
 	case OP_BUMPUP:
-		return byteInstruction("BUMP+", chunk, offset)
+		return "BUMP+"
 	case OP_BUMPDN:
-		return byteInstruction("BUMP-", chunk, offset)
-	case OP_NEGATE:
-		return simpleInstruction("NEGATE", offset)
-	default:
-		fmt.Printf("Unknown opcode %d.\n", instruction)
-		return offset + 1
+		return "BUMP-"
 	}
+	return ""
+}
+
+/* Returns the tile operand of an instruction, with brackets if the tile
+holds its address. */
+func tileOperand(in instruction) string {
+	if in.indirect {
+		return fmt.Sprintf("[%d]", in.tile)
+	}
+	return strconv.Itoa(in.tile)
 }
 
 /* Simple instructions do not take any operands. */
-func simpleInstruction(name string, offset int) int {
-	fmt.Printf("%s\n", name)
+func simpleInstruction(w io.Writer, name string, offset int) int {
+	fmt.Fprintf(w, "%s\n", name)
 	return offset + 1
 }
 
-/* Constant instructions are loaded from the chunk constant pool. */
-func constantInstruction(name string, chunk *Chunk, offset int) int {
-	constant := chunk.code[offset + 1]
-	fmt.Printf("%-16s %4d '", name, constant)
-	fmt.Printf("%v'\n", chunk.constants[constant])
-	return offset + 2
+/* Tile instructions use a tile, given directly or by the tile holding
+its address. */
+func tileInstruction(w io.Writer, name string, in instruction, offset int) int {
+	fmt.Fprintf(w, "%-16s %4s\n", name, tileOperand(in))
+	return offset + 1
 }
 
-/* Byte instructions take one byte argument. */
-func byteInstruction(name string, chunk *Chunk, offset int) int {
-	value := chunk.code[offset + 1]
-	fmt.Printf("%-16s %4d\n", name, value)
-	return offset + 2
+/* Jump instructions take the index of the instruction jumped to. */
+func jumpInstruction(w io.Writer, name string, in instruction, offset int) int {
+	fmt.Fprintf(w, "%-16s %04d\n", name, in.target)
+	return offset + 1
+}
+
+/* Returns the source mnemonic of an opcode, as written in a program. */
+func instructionName(op byte) string {
+	switch op {
+	case OP_INBOX:
+		return "INBOX"
+	case OP_OUTBOX:
+		return "OUTBOX"
+	case OP_JUMP:
+		return "JUMP"
+	case OP_JUMPZ:
+		return "JUMPZ"
+	case OP_JUMPN:
+		return "JUMPN"
+	case OP_COPYFROM:
+		return "COPYFROM"
+	case OP_COPYTO:
+		return "COPYTO"
+	case OP_ADD:
+		return "ADD"
+	case OP_SUB:
+		return "SUB"
+	case OP_BUMPUP:
+		return "BUMPUP"
+	case OP_BUMPDN:
+		return "BUMPDN"
+	}
+	return ""
 }
@@ -0,0 +1,291 @@
+package hrm
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* An enum of the ways a compiled program can be run. BACKEND_VM runs
+each instruction through the VM's switch. BACKEND_CLOSURE binds each
+instruction to a Go closure ahead of time, which returns the index of the
+instruction to run next. Both give the same outbox, steps and errors. */
+type Backend int
+const (
+	BACKEND_VM Backend = iota
+	BACKEND_CLOSURE
+)
+func (b Backend) String() string {
+	switch b {
+	case BACKEND_VM:
+		return "vm"
+	case BACKEND_CLOSURE:
+		return "closure"
+	}
+	return fmt.Sprintf("<Backend %d?>", int(b))
+}
+
+/* Returns the backend with the given name. */
+func ParseBackend(name string) (Backend, error) {
+	for _, b := range []Backend{BACKEND_VM, BACKEND_CLOSURE} {
+		if strings.EqualFold(name, b.String()) {
+			return b, nil
+		}
+	}
+	return BACKEND_VM, fmt.Errorf("Unknown backend '%s'. Use 'vm' or 'closure'.", name)
+}
+
+/* A closure runs one instruction on the VM's state, and returns the
+index of the instruction to run next, or CLOSURE_HALT once the program
+has stopped. */
+type closure func(vm *VM) int
+
+// Returned by a closure when the program stops, with vm.err set on failure
+const CLOSURE_HALT = -1
+
+/* Binds each instruction of a chunk to a closure, with its operands and
+the index of the next instruction already known. */
+func bindClosures(chunk *Chunk) []closure {
+	closures := make([]closure, len(chunk.code))
+	for i, in := range chunk.code {
+		closures[i] = bindInstruction(i, in)
+	}
+	return closures
+}
+
+/* Binds an instruction to a closure. Instructions which may fail record
+their index as vm.current, so that errors are raised against them. */
+func bindInstruction(i int, in instruction) closure {
+	next, tile, target := i + 1, in.tile, in.target
+	switch in.op {
+	case OP_HALT:
+		return func(vm *VM) int {
+			return CLOSURE_HALT
+		}
+	case OP_INBOX:
+		return func(vm *VM) int {
+			if len(vm.inbox) == 0 {
+				return CLOSURE_HALT
+			}
+			vm.take(vm.inbox[0])
+			vm.inbox = vm.inbox[1:]
+			vm.steps += 1
+			return next
+		}
+	case OP_OUTBOX:
+		return func(vm *VM) int {
+			value, ok := vm.drop()
+			if !ok {
+				vm.current = i
+				vm.raiseError(ERR_EMPTY_HAND, -1, EMPTY_HAND_ERROR, "OUTBOX")
+				return CLOSURE_HALT
+			}
+			*vm.outbox = append(*vm.outbox, value)
+			vm.steps += 1
+			return next
+		}
+	case OP_JUMP:
+		return func(vm *VM) int {
+			vm.steps += 1
+			return target
+		}
+	case OP_JUMPZ:
+		return func(vm *VM) int {
+			if vm.hand.Type == VAL_INT && vm.hand.Int == 0 {
+				vm.steps += 1
+				return target
+			}
+			if vm.stepMode == STEPS_GAME {
+				vm.steps += 1
+			}
+			return next
+		}
+	case OP_JUMPN:
+		return func(vm *VM) int {
+			if vm.hand.Type == VAL_INT && vm.hand.Int < 0 {
+				vm.steps += 1
+				return target
+			}
+			if vm.stepMode == STEPS_GAME {
+				vm.steps += 1
+			}
+			return next
+		}
+	}
+	if in.indirect {
+		return bindIndirect(i, in)
+	}
+	// Direct tiles are checked to be on the floor before the program runs
+	switch in.op {
+	case OP_COPYFROM:
+		return func(vm *VM) int {
+			value := vm.registers[tile]
+			if value.Type == VAL_EMPTY {
+				vm.current = i
+				vm.raiseError(ERR_EMPTY_TILE, tile, EMPTY_TILE_ERROR, "COPYFROM")
+				return CLOSURE_HALT
+			}
+			vm.hand = value
+			vm.steps += 1
+			return next
+		}
+	case OP_COPYTO:
+		return func(vm *VM) int {
+			if vm.hand.Type == VAL_EMPTY {
+				vm.current = i
+				vm.raiseError(ERR_EMPTY_HAND, tile, EMPTY_HAND_ERROR, "COPYTO")
+				return CLOSURE_HALT
+			}
+			vm.registers[tile] = vm.hand
+			vm.steps += 1
+			return next
+		}
+	case OP_ADD:
+		return func(vm *VM) int {
+			vm.current = i
+			value, ok := vm.checkRegister(tile, "ADD")
+			if !ok || !vm.arithmetic(Value.Add, tile, value, "ADD") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_SUB:
+		return func(vm *VM) int {
+			vm.current = i
+			value, ok := vm.checkRegister(tile, "SUB")
+			if !ok || !vm.arithmetic(Value.Sub, tile, value, "SUB") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_BUMPUP:
+		return func(vm *VM) int {
+			vm.current = i
+			if !vm.bumpRegister(tile, 1, "BUMP+") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_BUMPDN:
+		return func(vm *VM) int {
+			vm.current = i
+			if !vm.bumpRegister(tile, -1, "BUMP-") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	}
+	return func(vm *VM) int {
+		vm.current = i
+		vm.raiseError(ERR_UNKNOWN_OPCODE, -1, "Unknown opcode %d.", in.op)
+		return CLOSURE_HALT
+	}
+}
+
+/* Binds an instruction with an indirect tile. The address is read from
+its tile each time it runs, and goes through the same checks as the VM. */
+func bindIndirect(i int, in instruction) closure {
+	next, tile := i + 1, in.tile
+	switch in.op {
+	case OP_COPYFROM:
+		return func(vm *VM) int {
+			vm.current = i
+			register, ok := vm.derefRegister(tile)
+			if !ok || !vm.takeRegister(register, "COPYFROM") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_COPYTO:
+		return func(vm *VM) int {
+			vm.current = i
+			register, ok := vm.derefRegister(tile)
+			if !ok || !vm.copyRegister(register, "COPYTO") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_ADD:
+		return func(vm *VM) int {
+			vm.current = i
+			register, ok := vm.derefRegister(tile)
+			if !ok {
+				return CLOSURE_HALT
+			}
+			value, ok := vm.checkRegister(register, "ADD")
+			if !ok || !vm.arithmetic(Value.Add, register, value, "ADD") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_SUB:
+		return func(vm *VM) int {
+			vm.current = i
+			register, ok := vm.derefRegister(tile)
+			if !ok {
+				return CLOSURE_HALT
+			}
+			value, ok := vm.checkRegister(register, "SUB")
+			if !ok || !vm.arithmetic(Value.Sub, register, value, "SUB") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_BUMPUP:
+		return func(vm *VM) int {
+			vm.current = i
+			register, ok := vm.derefRegister(tile)
+			if !ok || !vm.bumpRegister(register, 1, "BUMP+") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	case OP_BUMPDN:
+		return func(vm *VM) int {
+			vm.current = i
+			register, ok := vm.derefRegister(tile)
+			if !ok || !vm.bumpRegister(register, -1, "BUMP-") {
+				return CLOSURE_HALT
+			}
+			vm.steps += 1
+			return next
+		}
+	}
+	return func(vm *VM) int {
+		vm.current = i
+		vm.raiseError(ERR_UNKNOWN_OPCODE, -1, "Unknown opcode %d.", in.op)
+		return CLOSURE_HALT
+	}
+}
+
+/* Executes a chunk from its first instruction, by running the closures
+bound from it. Like Execute, the chunk is verified first. The closures do
+not trace to vm.debug. */
+func (vm *VM) executeClosures(chunk *Chunk, closures []closure) INTERPRET_STATE {
+	vm.reset(chunk)
+	if err := chunk.verify(len(vm.registers)); err != nil {
+		vm.err = err
+		return INTERPRET_RUNTIME_ERROR
+	}
+	return vm.runClosures(closures)
+}
+
+/* Runs closures until the program stops. */
+func (vm *VM) runClosures(closures []closure) INTERPRET_STATE {
+	ip := 0
+	for ip != CLOSURE_HALT {
+		ip = closures[ip](vm)
+	}
+	if vm.err != nil {
+		return INTERPRET_RUNTIME_ERROR
+	}
+	return INTERPRET_OK
+}
@@ -2,38 +2,72 @@ package hrm
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 )
 
-/* A parser is used to generate bytecode for the interpreter. */
+const OFF_FLOOR_ERROR = "There is no tile %d on any floor! The largest has only %d slots."
+
+/* A parser builds the AST of a program, which is then lowered to
+instructions for the interpreter. Comments and DEFINE blocks found between
+tokens are kept in skipped until the statement being parsed is added. */
 type Parser struct {
-	backpatch map[string][]Label
 	current Token
 	previous Token
 	hasError bool
 	errorState bool
-	labels map[string]byte
-	chunk *Chunk
+	ast *Ast
+	skipped []Node
+	labels map[string]int
+	declarations map[string]Token
+	uses map[string]int
+	jumps []Token
+	tiles map[string]int
+	tileDeclarations map[string]Token
+	definitions []Definition
+	comments []Comment
+	comment Token
+	diagnostics []Diagnostic
 	scanner *Scanner
 	size int
 }
 
-type Label struct {
-	offset int
-	token Token
+/* Reports an error in a comment or DEFINE block, which are skipped
+between tokens. Any error of the statement being parsed is kept. */
+func (p *Parser) raiseSkipped(token Token, kind ErrorKind, err string) {
+	state := p.errorState
+	p.errorState = false
+	p.raiseError(token, kind, err)
+	p.errorState = state
 }
 
-/* Handler for compile-time errors. */
-func (p *Parser) raiseError(token Token, err string) {
+/* Handler for compile-time errors. Only the first error of a statement is
+reported, as later errors are likely caused by the first. */
+func (p *Parser) raiseError(token Token, kind ErrorKind, err string) {
 	if p.errorState {
 		return
 	}
-	fmt.Printf("[Ln %d:%d] Parsing error: %s\n", token.line, token.column, err)
+	length := len(token.Literal)
+	switch token.Type {
+	case NEWLINE, EOF, ERROR:
+		length = 1
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Line: token.line,
+		Column: token.column,
+		Length: length,
+		Kind: kind,
+		Severity: SEVERITY_ERROR,
+		Message: err,
+		Text: p.scanner.Line(token.line),
+	})
 	p.hasError = true
 	p.errorState = true
 }
 
-/* Ignores upcoming tokens in an effort to recover from the error state. */
+/* Ignores upcoming tokens in an effort to recover from the error state.
+Parsing resumes at the start of the next line, or at the next instruction. */
 func (p *Parser) synchronize() {
 	p.errorState = false
 	for p.previous.Type != EOF {
@@ -41,7 +75,7 @@ func (p *Parser) synchronize() {
 			return
 		}
 		switch p.current.Type {
-		case INBOX, OUTBOX, JUMP, JUMPZ:
+		case NEWLINE, EOF, INBOX, OUTBOX, JUMP, JUMPZ, JUMPN, COPYFROM, COPYTO, ADD, SUB, BUMPUP, BUMPDN, COMMENT, TILE:
 			return
 		// Otherwise, skip the current token
 		}
@@ -49,17 +83,27 @@ func (p *Parser) synchronize() {
 	}
 }
 
-/* Retrieves and sets the next available token. */
+/* Retrieves and sets the next available token. Comments and DEFINE
+blocks do not affect the program, so they are skipped. The last comment
+is kept, as it may name the block after it. */
 func (p *Parser) advance() {
 	p.previous = p.current
 	for {
 		p.current = p.scanner.ScanToken()
-		if p.current.Type != ERROR {
-			break
+		switch p.current.Type {
+		case LINE_COMMENT:
+			p.comment = p.current
+			p.remark(p.current)
+			continue
+		case DEFINE:
+			p.define(p.current, p.comment)
+			continue
+		case ERROR:
+			// Report errors while scanning tokens
+			p.raiseError(p.current, ERR_UNEXPECTED_CHARACTER, p.current.Literal)
+			continue
 		}
-		// Report errors while scanning tokens
-		p.raiseError(p.current, p.current.Literal)
-		p.advance()
+		break
 	}
 }
 
@@ -69,7 +113,7 @@ func (p *Parser) consume(tokenType TokenType, err string) {
 		p.advance()
 		return
 	}
-	p.raiseError(p.current, err)
+	p.raiseError(p.current, ERR_EXPECTED_TOKEN, err)
 }
 
 /* Matches the next token to a type, advancing the parser if
@@ -87,49 +131,36 @@ func (p *Parser) check(tokenType TokenType) bool {
 	return p.current.Type == tokenType
 }
 
-/* Checks if all labels used are declared.
-This is done by ensuring no more labels need to be backpatched. */
+/* Checks if all labels used are declared, now that every label has
+been seen. Every use of an unknown label is reported, in source order. */
 func (p *Parser) checkLabels() bool {
-	if len(p.backpatch) > 0 {
-		for label, data := range p.backpatch {
-			p.raiseError(data[0].token, fmt.Sprintf("Unknown label '%s'.", label))
-			return false
-		}
-	}
-	return true
-}
-
-/* Patches labels which were used before declaration by setting the jump offset. */
-func (p *Parser) patchLabel(label string) {
-	if labels, ok := p.backpatch[label]; ok {
-		for _, data := range labels {
-			p.chunk.code[data.offset] = p.labels[label]
+	known := true
+	for _, token := range p.jumps {
+		if _, ok := p.declarations[token.Literal]; !ok {
+			p.errorState = false
+			p.raiseError(token, ERR_UNKNOWN_LABEL, fmt.Sprintf("Unknown label '%s'.", token.Literal))
+			known = false
 		}
-		// Label no longer needs backpatching since it is declared
-		delete(p.backpatch, label)
 	}
+	return known
 }
 
-/* Writes a bytecode instruction to the current chunk. */
-func (p *Parser) emitByte(b byte) {
-	p.chunk.Write(b, p.previous.line)
+/* Adds a node to the AST, followed by any comments and DEFINE blocks
+skipped while parsing it. */
+func (p *Parser) addNode(node Node) {
+	p.ast.Nodes = append(p.ast.Nodes, node)
+	p.addSkipped()
 }
 
-/* Writes 2 bytecode instructions to the current chunk. */
-func (p *Parser) emitBytes(b1, b2 byte) {
-	p.emitByte(b1)
-	p.emitByte(b2)
+/* Adds the comments and DEFINE blocks skipped so far to the AST. */
+func (p *Parser) addSkipped() {
+	p.ast.Nodes = append(p.ast.Nodes, p.skipped...)
+	p.skipped = p.skipped[:0]
 }
 
-/* Emits a HALT instruction. */
-func (p *Parser) emitHalt() {
-	p.emitByte(OP_HALT)
-}
-
-/* Emits a CONSTANT instruction followed by its index in the constant pool. */
-func (p *Parser) emitConstant(v Value) {
-	index := byte(p.chunk.AddConst(v))
-	p.emitBytes(OP_CONSTANT, index)
+/* Returns the span from a token to the last token consumed. */
+func (p *Parser) spanFrom(start Token) Span {
+	return joinSpans(tokenSpan(start), tokenSpan(p.previous))
 }
 
 /* Precedence levels specify the parsing order of productions. */
@@ -140,194 +171,338 @@ const (
 	PREC_PRIMARY
 )
 
-/* Parses a statement. */
+/* Parses a statement, adding it to the AST unless it has an error. */
 func (p *Parser) statement() {
+	start := p.current
+	var node Node
 	switch {
-	case p.match(NEWLINE):
+	case p.match(NEWLINE), p.match(EOF):
+		p.addSkipped()
 		return
 	case p.match(INBOX):
-		p.inbox()
-		p.size += 1
+		node = p.instruction(OP_INBOX, Operand{})
 	case p.match(OUTBOX):
-		p.outbox()
-		p.size += 1
+		node = p.instruction(OP_OUTBOX, Operand{})
 	case p.match(JUMP):
-		p.jump()
-		p.size += 1
+		node = p.instruction(OP_JUMP, p.target())
 	case p.match(JUMPZ):
-		p.jumpIfZero()
-		p.size += 1
+		node = p.instruction(OP_JUMPZ, p.target())
 	case p.match(JUMPN):
-		p.jumpIfNegative()
-		p.size += 1
+		node = p.instruction(OP_JUMPN, p.target())
 	case p.match(COPYFROM):
-		p.copyfrom()
-		p.size += 1
+		node = p.instruction(OP_COPYFROM, p.address())
 	case p.match(COPYTO):
-		p.copyto()
-		p.size += 1
+		node = p.instruction(OP_COPYTO, p.address())
 	case p.match(ADD):
-		p.add()
-		p.size += 1
+		node = p.instruction(OP_ADD, p.address())
 	case p.match(SUB):
-		p.sub()
-		p.size += 1
+		node = p.instruction(OP_SUB, p.address())
 	case p.match(BUMPUP):
-		p.bumpUp()
-		p.size += 1
+		node = p.instruction(OP_BUMPUP, p.address())
 	case p.match(BUMPDN):
-		p.bumpDown()
-		p.size += 1
+		node = p.instruction(OP_BUMPDN, p.address())
+	case p.match(COMMENT):
+		node = p.commentInstruction()
+	case p.match(TILE):
+		node = p.tileDeclaration()
 	case p.match(LABEL):
 		p.labelDeclaration()
-	case p.match(EOF):
 		return
 	default:
-		p.exprStatement()
+		node = p.exprStatement()
+	}
+	p.endOfLine()
+	if p.errorState {
+		p.addSkipped()
+		return
 	}
+	node.Span = p.spanFrom(start)
+	p.addNode(node)
 }
 
-/* Parses an expression statement, which evaluates without affecting
-the VM stack. */
-func (p *Parser) exprStatement() {
-	p.expression()
-	// Immediately ignore the last expression result
-	p.emitByte(OP_POP)
+/* Returns an instruction node, counting it in the size of the program. */
+func (p *Parser) instruction(op byte, operand Operand) Node {
+	p.size += 1
+	return Node{Type: NODE_INSTRUCTION, Op: op, Operand: operand}
 }
 
-/* Parses a label declaration. Jump offsets are handled by the compiler. */
-func (p *Parser) labelDeclaration() {
-	label := p.previous.Literal
-	p.consume(COLON, "Expected ':' after label declaration.")
-	if _, ok := p.labels[label]; ok {
-		p.raiseError(p.previous, fmt.Sprintf("Label '%s' already used.", label))
-	} else {
-		p.labels[label] = byte(p.chunk.count)
-		p.patchLabel(label)
+/* Checks that nothing follows an instruction on the same line. */
+func (p *Parser) endOfLine() {
+	if p.check(NEWLINE) || p.check(EOF) {
+		return
 	}
+	p.raiseError(p.current, ERR_EXPECTED_TOKEN, fmt.Sprintf("Unexpected '%s' after instruction.", p.current))
 }
 
-/* Parses an INBOX instruction. */
-func (p *Parser) inbox() {
-	p.emitByte(OP_INBOX)
+/* Parses an expression statement, a lone number which does not affect
+the program. */
+func (p *Parser) exprStatement() Node {
+	return Node{Type: NODE_EXPRESSION, Value: p.expression()}
 }
 
-/* Parses an OUTBOX instruction. */
-func (p *Parser) outbox() {
-	p.emitByte(OP_OUTBOX)
+/* Parses a label declaration. Jump targets are given to labels when the
+AST is lowered. */
+func (p *Parser) labelDeclaration() {
+	token := p.previous
+	label := token.Literal
+	p.consume(COLON, "Expected ':' after label declaration.")
+	if p.errorState {
+		return
+	}
+	if _, ok := p.declarations[label]; ok {
+		p.raiseError(token, ERR_DUPLICATE_LABEL, fmt.Sprintf("Label '%s' already used.", label))
+		return
+	}
+	p.declarations[label] = token
+	p.addNode(Node{Type: NODE_LABEL, Name: label, Span: p.spanFrom(token)})
+}
+
+/* Parses a COMMENT n instruction, which places the drawing n on the
+program. Comments are not counted in the size of the program, and emit
+no instructions. */
+func (p *Parser) commentInstruction() Node {
+	token := p.previous
+	if !p.match(INT) {
+		p.raiseError(p.current, ERR_EXPECTED_TOKEN, "Expected a comment number after 'COMMENT'.")
+		return Node{Type: NODE_COMMENT}
+	}
+	index := p.number()
+	p.comments = append(p.comments, Comment{Index: index, Line: token.line, token: token})
+	return Node{Type: NODE_COMMENT, Value: index}
 }
 
-/* Parses a JUMP [label] instruction. */
-func (p *Parser) jump() {
-	p.emitByte(OP_JUMP)
-	p.primary()
+/* Parses a TILE name = n declaration, which names a tile so that it can
+be used as an operand. Like comments, it emits no instructions. */
+func (p *Parser) tileDeclaration() Node {
+	if !p.match(LABEL) {
+		p.raiseError(p.current, ERR_EXPECTED_TOKEN, "Expected a tile name after 'TILE'.")
+		return Node{}
+	}
+	name := p.previous
+	p.consume(EQUAL, "Expected '=' after tile name.")
+	if p.errorState {
+		return Node{}
+	}
+	if !p.match(INT) {
+		p.raiseError(p.current, ERR_EXPECTED_TOKEN, "Expected a tile number after '='.")
+		return Node{}
+	}
+	// A tile out of range is still named, so that its uses are not
+	// reported as well
+	tile := p.tileNumber()
+	p.declareTile(name, tile, p.raiseError)
+	return Node{Type: NODE_TILE, Name: name.Literal, Value: tile}
+}
+
+/* Parses a "--" comment. A "-- @tile n name" comment names a tile like a
+TILE declaration, but is ignored by the game. Other comments are kept as
+remarks. */
+func (p *Parser) remark(token Token) {
+	text := strings.TrimSpace(token.Literal)
+	fields := strings.Fields(strings.TrimPrefix(text, "--"))
+	if len(fields) == 0 || fields[0] != "@tile" {
+		p.skipped = append(p.skipped, Node{Type: NODE_REMARK, Text: text, Span: tokenSpan(token)})
+		return
+	}
+	tile, err := strconv.Atoi(safeField(fields, 1))
+	name := safeField(fields, 2)
+	if err != nil || tile < 0 || len(fields) != 3 || !isName(name) {
+		p.raiseSkipped(token, ERR_EXPECTED_TOKEN, "Expected '-- @tile <number> <name>'.")
+		return
+	}
+	if tile >= MAX_FLOOR {
+		p.raiseSkipped(token, ERR_OUT_OF_RANGE, fmt.Sprintf(OFF_FLOOR_ERROR, tile, MAX_FLOOR))
+	}
+	// Point the name token at the name within the comment
+	named := token
+	named.Literal = name
+	named.column += strings.LastIndex(token.Literal, name)
+	named.Type = LABEL
+	p.declareTile(named, tile, p.raiseSkipped)
+	p.skipped = append(p.skipped, Node{Type: NODE_TILE, Name: name, Value: tile, Text: text, Span: tokenSpan(token)})
+}
+
+/* Names a tile, reporting names which are already used. */
+func (p *Parser) declareTile(name Token, tile int, raise func(Token, ErrorKind, string)) {
+	if _, ok := p.tiles[name.Literal]; ok {
+		raise(name, ERR_DUPLICATE_TILE, fmt.Sprintf("Tile name '%s' already used.", name.Literal))
+		return
+	}
+	p.tiles[name.Literal] = tile
+	p.tileDeclarations[name.Literal] = name
 }
 
-/* Parses a JUMPZ [label] instruction. */
-func (p *Parser) jumpIfZero() {
-	p.emitByte(OP_JUMPZ)
-	p.primary()
+/* Returns field i, or "" if there are not enough fields. */
+func safeField(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
 }
 
-/* Parses a JUMPN [label] instruction. */
-func (p *Parser) jumpIfNegative() {
-	p.emitByte(OP_JUMPN)
-	p.primary()
+/* Checks if a word is a name which is not a keyword, as a tile name must be. */
+func isName(word string) bool {
+	if word == "" || !isAlpha(word[0]) {
+		return false
+	}
+	for i := 0; i < len(word); i += 1 {
+		if !isIdentifier(word[i]) {
+			return false
+		}
+	}
+	var scanner Scanner
+	scanner.Init(word)
+	return scanner.ScanToken().Type == LABEL
 }
 
-/* Parses a COPYFROM [addr] instruction. */
-func (p *Parser) copyfrom() {
-	p.primary()
-	p.emitByte(OP_COPYFROM)
+/* Parses an expression, returning its value. */
+func (p *Parser) expression() int {
+	return p.unary()
 }
 
-/* Parses a COPYTO [addr] instruction. */
-func (p *Parser) copyto() {
-	p.primary()
-	p.emitByte(OP_COPYTO)
+/* Parses a unary expression. */
+func (p *Parser) unary() int {
+	if p.match(MINUS) {
+		return -p.unary()
+	}
+	return p.primary()
 }
 
-/* Parses an ADD [addr] instruction. */
-func (p *Parser) add() {
-	p.primary()
-	p.emitByte(OP_ADD)
+/* Parses a primary expression (literal). */
+func (p *Parser) primary() int {
+	switch {
+	case p.match(INT):
+		return p.number()
+	case p.check(NEWLINE) || p.check(EOF):
+		p.raiseError(p.current, ERR_EXPECTED_TOKEN, fmt.Sprintf("Expected an operand after '%s'.", p.previous))
+	default:
+		p.raiseError(p.current, ERR_UNEXPECTED_TOKEN, fmt.Sprintf("Unexpected token '%s'.", p.current))
+		p.advance()
+	}
+	return 0
 }
 
-/* Parses a SUB [addr] instruction. */
-func (p *Parser) sub() {
+/* Parses the label a jump goes to. */
+func (p *Parser) target() Operand {
+	switch {
+	case p.match(LABEL):
+		return p.label()
+	case p.check(NEWLINE) || p.check(EOF):
+		p.raiseError(p.current, ERR_EXPECTED_TOKEN, fmt.Sprintf("Expected an operand after '%s'.", p.previous))
+	default:
+		p.raiseError(p.current, ERR_UNEXPECTED_TOKEN, fmt.Sprintf("Unexpected token '%s'.", p.current))
+		p.advance()
+	}
+	return Operand{}
+}
+
+/* Parses a tile address, which is either a direct operand (COPYFROM 3)
+or an indirect operand (COPYFROM [3]) that uses the value of the tile
+as the address. A named tile may be used in place of its number. */
+func (p *Parser) address() Operand {
+	start := p.current
+	if p.match(LEFT_BRACKET) {
+		operand := p.indirect()
+		operand.Span = p.spanFrom(start)
+		return operand
+	}
+	if p.match(LABEL) {
+		return p.tile()
+	}
+	if p.match(INT) {
+		return Operand{Type: OPERAND_TILE, Tile: p.tileNumber(), Span: p.spanFrom(start)}
+	}
 	p.primary()
-	p.emitByte(OP_SUB)
+	return Operand{Type: OPERAND_TILE, Span: p.spanFrom(start)}
 }
 
-/* Parses a BUMPUP [addr] instruction. */
-func (p *Parser) bumpUp() {
-	p.primary()
-	p.emitByte(OP_BUMPUP)
+/* Parses an indirect address [n]. The VM uses the value of tile n as
+the address at runtime. */
+func (p *Parser) indirect() Operand {
+	var operand Operand
+	switch {
+	case p.match(INT):
+		operand = Operand{Tile: p.tileNumber()}
+	case p.match(LABEL):
+		operand = p.tile()
+	default:
+		p.raiseError(p.current, ERR_EXPECTED_TOKEN, "Expected tile address after '['.")
+		return operand
+	}
+	p.consume(RIGHT_BRACKET, "Expected ']' after tile address.")
+	operand.Type = OPERAND_INDIRECT
+	return operand
 }
 
-/* Parses a BUMPDN [addr] instruction. */
-func (p *Parser) bumpDown() {
-	p.primary()
-	p.emitByte(OP_BUMPDN)
+/* Parses a number, reporting numbers too large to hold. */
+func (p *Parser) number() int {
+	num, err := strconv.Atoi(p.previous.Literal)
+	if err != nil {
+		p.raiseError(p.previous, ERR_OUT_OF_RANGE, fmt.Sprintf("Number '%s' is too large.", p.previous.Literal))
+	}
+	return num
 }
 
-/* Parses an expression. */
-func (p *Parser) expression() {
-	p.unary()
+/* Parses the number of a tile, reporting tiles which are on no floor in
+the game. */
+func (p *Parser) tileNumber() int {
+	tile := p.number()
+	if tile >= MAX_FLOOR {
+		p.raiseError(p.previous, ERR_OUT_OF_RANGE, fmt.Sprintf(OFF_FLOOR_ERROR, tile, MAX_FLOOR))
+	}
+	return tile
 }
 
-/* Parses a unary expression. */
-func (p *Parser) unary() {
-	switch {	
-	case p.match(MINUS):
-		p.unary()
-		p.emitByte(OP_NEGATE)
-	default:
-		p.primary()
+/* Parses a tile name, resolving it to the number of the tile. Tiles must
+be named before they are used. */
+func (p *Parser) tile() Operand {
+	token := p.previous
+	tile, ok := p.tiles[token.Literal]
+	if !ok {
+		p.raiseError(token, ERR_UNKNOWN_TILE, fmt.Sprintf("Unknown tile '%s'. Name it first with 'TILE %s = <number>'.", token.Literal, token.Literal))
 	}
+	return Operand{Type: OPERAND_TILE, Tile: tile, Name: token.Literal, Span: tokenSpan(token)}
 }
 
-/* Parses a primary expression (literal). */
-func (p *Parser) primary() {
-	switch {
-	case p.match(INT):
-		p.number()
-	case p.match(LABEL):
-		p.label()
-	default:
-		p.raiseError(p.current, fmt.Sprintf("Unexpected token '%s'.", p.current))
-		p.advance()
-	}
+/* Parses a label (identifier). It is checked once every label is
+declared, as jumps may go forward. */
+func (p *Parser) label() Operand {
+	token := p.previous
+	p.uses[token.Literal] += 1
+	p.jumps = append(p.jumps, token)
+	return Operand{Type: OPERAND_LABEL, Name: token.Literal, Span: tokenSpan(token)}
 }
 
-/* Parses a number. */
-func (p *Parser) number() {
-	num, _ := strconv.Atoi(p.previous.Literal)
-	p.emitConstant(IntVal(num))
+/* Compiles the source code into a chunk. Returns the size of the
+program in instructions, and any problems found in the source. */
+func compile(source string, chunk *Chunk) (int, []Diagnostic) {
+	parser := parse(source, chunk)
+	return parser.size, parser.diagnostics
 }
 
-/* Parses a label (identifier), but emits the jump offset. */
-func (p *Parser) label() {
-	label := p.previous.Literal
-	if offset, ok := p.labels[label]; ok {
-		p.emitByte(byte(offset))
-	} else {
-		data := Label{offset: p.chunk.count, token: p.previous}
-		p.backpatch[label] = append(p.backpatch[label], data)
-		p.emitByte(0)
+/* Parses the source code into a chunk, returning the parser so that
+the labels it found can be inspected. The chunk is only written if the
+source has no errors. */
+func parse(source string, chunk *Chunk) *Parser {
+	parser := parseAst(source)
+	if len(parser.diagnostics) == 0 {
+		parser.labels = parser.ast.lower(chunk)
 	}
+	return parser
 }
 
-
-/* Compiles the source code into a chunk. */
-func (vm *VM) Compile(source string, chunk *Chunk) (int, bool) {
+/* Parses the source code into an AST, held by the returned parser. */
+func parseAst(source string) *Parser {
 	var scanner Scanner
 	var parser Parser
 	scanner.Init(source)
 	parser.scanner = &scanner
-	parser.chunk = chunk
-	parser.backpatch = map[string][]Label{}
-	parser.labels = map[string]byte{}
+	parser.ast = &Ast{}
+	parser.labels = map[string]int{}
+	parser.declarations = map[string]Token{}
+	parser.uses = map[string]int{}
+	parser.tiles = map[string]int{}
+	parser.tileDeclarations = map[string]Token{}
 	parser.advance()
 	for parser.previous.Type != EOF {
 		parser.statement()
@@ -336,7 +511,13 @@ func (vm *VM) Compile(source string, chunk *Chunk) (int, bool) {
 		}
 	}
 	parser.consume(EOF, "Expected EOF.")
-	parser.emitHalt()
+	parser.addSkipped()
+	parser.ast.End = parser.previous.line
 	parser.checkLabels()
-	return parser.size, !parser.hasError
+	parser.link()
+	sort.SliceStable(parser.diagnostics, func(i, j int) bool {
+		a, b := parser.diagnostics[i], parser.diagnostics[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return &parser
 }
@@ -0,0 +1,84 @@
+package hrm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutOfRangeNumbers(t *testing.T) {
+	sources := []string{
+		"TILE d = 99999999999999999999\nCOPYTO d\n",
+		"INBOX\nCOPYTO 99999999999\n",
+		"INBOX\nCOPYTO 25\n",
+		"INBOX\nCOPYFROM [99]\n",
+		"-- @tile 30 x\nINBOX\nCOPYTO x\n",
+		"COMMENT 99999999999999999999\n",
+		"99999999999999999999\n",
+	}
+	for _, source := range sources {
+		_, diagnostics := Compile(source)
+		if len(diagnostics) != 1 || diagnostics[0].Kind != ERR_OUT_OF_RANGE {
+			t.Errorf("%q: expected one out of range error, got %v.", source, diagnostics)
+		}
+	}
+	if _, diagnostics := Compile("INBOX\nCOPYTO 24\nOUTBOX\n"); len(diagnostics) > 0 {
+		t.Errorf("Tile 24 is on the largest floor, but got %v.", diagnostics)
+	}
+}
+
+/* Jumps can reach any instruction, however far, so programs longer than
+255 instructions compile and run. */
+func TestLargeProgram(t *testing.T) {
+	source := "a:\n    INBOX\n    JUMPZ b\n" + strings.Repeat("    COPYTO 0\n", 300) + "    OUTBOX\n    JUMP a\nb:\n    OUTBOX\n    JUMP a\n"
+	program := compileTest(t, source)
+	if program.Size != 306 {
+		t.Errorf("Expected 306 instructions, got %d.", program.Size)
+	}
+	inbox := Inbox{IntVal(1), IntVal(0), IntVal(2)}
+	for _, backend := range []Backend{BACKEND_VM, BACKEND_CLOSURE} {
+		result, err := execute(program, inbox, make(Floor, 1), TestConfig{Backend: backend})
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		if err := compareOutbox(inbox, result.Outbox); err != nil {
+			t.Errorf("%s: %v", backend, err)
+		}
+	}
+}
+
+/* A source with three independent errors, each of which must be reported
+once, without errors caused by recovering from the others. */
+const THREE_ERRORS = "    INBOX\n    JUMP nowhere\n\tCOPYTO $\n    OUTBOX 3 4\n"
+
+func TestSeveralErrors(t *testing.T) {
+	_, diagnostics := Compile(THREE_ERRORS)
+	expected := []struct {
+		code string
+		line int
+		column int
+		excerpt string
+	}{
+		{"E004", 2, 10, "[Ln 2:10] Error E004: Unknown label 'nowhere'.\n" +
+			"   2 |     JUMP nowhere\n" +
+			"     |          ^~~~~~~"},
+		// The caret keeps the tab, so it lines up however tabs are shown
+		{"E001", 3, 9, "[Ln 3:9] Error E001: Unexpected character '$'.\n" +
+			"   3 | \tCOPYTO $\n" +
+			"     | \t       ^"},
+		{"E003", 4, 12, "[Ln 4:12] Error E003: Unexpected '3' after instruction.\n" +
+			"   4 |     OUTBOX 3 4\n" +
+			"     |            ^"},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v.", len(expected), diagnostics)
+	}
+	for i, d := range diagnostics {
+		e := expected[i]
+		if d.Kind.Code() != e.code || d.Line != e.line || d.Column != e.column {
+			t.Errorf("Expected %s at %d:%d, got %v.", e.code, e.line, e.column, d)
+		}
+		if excerpt := d.Excerpt(); excerpt != e.excerpt {
+			t.Errorf("Expected the excerpt\n%s\ngot\n%s", e.excerpt, excerpt)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package hrm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+/* A DAP server speaks the Debug Adapter Protocol, so that editors such
+as VS Code can debug HRM programs. Messages are read from in and written
+to out, each with a Content-Length header. There is a single thread, with
+a single stack frame for the instruction about to run. */
+type dapServer struct {
+	reader *bufio.Reader
+	out io.Writer
+	write sync.Mutex
+	seq int
+	run sync.Mutex
+	debugger *Debugger
+	path string
+	names map[int]string
+	lines []int
+	stopOnEntry bool
+	failed bool
+	running int32
+}
+
+/* A message sent by the client. Only requests are expected. */
+type dapRequest struct {
+	Seq int `json:"seq"`
+	Type string `json:"type"`
+	Command string `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+/* The arguments of a launch request. The program is tested against the
+level's exhaustive inbox, or a random one if runs is given. */
+type dapLaunch struct {
+	Program string `json:"program"`
+	Level int `json:"level"`
+	Runs int `json:"runs"`
+	Seed int64 `json:"seed"`
+	StopOnEntry bool `json:"stopOnEntry"`
+}
+
+// Variable references of the scopes and lists shown by the client
+const (
+	DAP_PROGRAM = iota + 1
+	DAP_FLOOR
+	DAP_INBOX
+	DAP_OUTBOX
+)
+
+/* Serves the Debug Adapter Protocol until the client disconnects or the
+input ends. */
+func ServeDAP(in io.Reader, out io.Writer) error {
+	s := &dapServer{reader: bufio.NewReader(in), out: out}
+	for {
+		request, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !s.handle(request) {
+			return nil
+		}
+	}
+}
+
+/* Reads the next message from the client. */
+func (s *dapServer) read() (dapRequest, error) {
+	var request dapRequest
+	body, err := readMessage(s.reader)
+	if err != nil {
+		return request, err
+	}
+	err = json.Unmarshal(body, &request)
+	return request, err
+}
+
+/* Writes a message to the client. Events may be sent while a request is
+being handled, so writes are serialized. */
+func (s *dapServer) send(message map[string]interface{}) {
+	s.write.Lock()
+	defer s.write.Unlock()
+	s.seq += 1
+	message["seq"] = s.seq
+	body, _ := json.Marshal(message)
+	writeMessage(s.out, body)
+}
+
+/* Responds to a request, successfully unless err is not nil. */
+func (s *dapServer) respond(request dapRequest, body interface{}, err error) {
+	message := map[string]interface{}{
+		"type": "response",
+		"request_seq": request.Seq,
+		"command": request.Command,
+		"success": err == nil,
+	}
+	if err != nil {
+		message["message"] = err.Error()
+	}
+	if body != nil {
+		message["body"] = body
+	}
+	s.send(message)
+}
+
+/* Sends an event to the client. */
+func (s *dapServer) event(name string, body interface{}) {
+	message := map[string]interface{}{"type": "event", "event": name}
+	if body != nil {
+		message["body"] = body
+	}
+	s.send(message)
+}
+
+/* Handles a request. Returns false once the client has disconnected. */
+func (s *dapServer) handle(request dapRequest) bool {
+	switch request.Command {
+	case "initialize":
+		s.respond(request, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsStepBack": true,
+			"supportsRestartRequest": true,
+			"supportsTerminateRequest": true,
+		}, nil)
+		s.event("initialized", nil)
+	case "launch":
+		s.respond(request, nil, s.launch(request.Arguments))
+	case "setBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		s.lines = s.lines[:0]
+		for _, b := range args.Breakpoints {
+			s.lines = append(s.lines, b.Line)
+		}
+		s.respond(request, map[string]interface{}{"breakpoints": s.setBreakpoints()}, nil)
+	case "configurationDone":
+		s.respond(request, nil, nil)
+		if s.debugger != nil {
+			s.start(func() Stop {
+				if s.stopOnEntry {
+					return Stop{STOP_START, ""}
+				}
+				return s.debugger.Continue()
+			})
+		}
+	case "threads":
+		s.respond(request, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": 1, "name": "Worker"}},
+		}, nil)
+	case "stackTrace":
+		if err := s.inspect(); err != nil {
+			s.respond(request, nil, err)
+			break
+		}
+		s.respond(request, s.stackTrace(), nil)
+		s.run.Unlock()
+	case "scopes":
+		s.respond(request, map[string]interface{}{
+			"scopes": []map[string]interface{}{
+				{"name": "Program", "variablesReference": DAP_PROGRAM, "expensive": false},
+				{"name": "Floor", "variablesReference": DAP_FLOOR, "expensive": false},
+			},
+		}, nil)
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		if err := s.inspect(); err != nil {
+			s.respond(request, nil, err)
+			break
+		}
+		s.respond(request, map[string]interface{}{"variables": s.variables(args.VariablesReference)}, nil)
+		s.run.Unlock()
+	case "continue":
+		s.resume(request, map[string]interface{}{"allThreadsContinued": true}, s.debugger.Continue)
+	case "next", "stepOut":
+		// There are no subroutines, so stepping out finishes the loop
+		s.resume(request, nil, s.debugger.Next)
+	case "stepIn":
+		s.resume(request, nil, s.debugger.Step)
+	case "stepBack":
+		s.resume(request, nil, s.debugger.ReverseStep)
+	case "reverseContinue":
+		s.resume(request, nil, s.debugger.ReverseContinue)
+	case "pause":
+		s.respond(request, nil, nil)
+		if s.debugger != nil {
+			s.debugger.Pause()
+		}
+	case "restart":
+		if s.debugger == nil {
+			s.respond(request, nil, fmt.Errorf("No program has been launched."))
+			break
+		}
+		s.interrupt()
+		s.debugger.Restart()
+		s.failed = false
+		s.run.Unlock()
+		s.respond(request, nil, nil)
+		s.stopped(Stop{STOP_START, ""})
+	case "terminate":
+		// The program is paused first, so that it sends nothing after
+		// the client is told it terminated
+		if s.debugger != nil {
+			s.interrupt()
+		}
+		s.respond(request, nil, nil)
+		s.event("terminated", nil)
+		if s.debugger != nil {
+			s.run.Unlock()
+		}
+	case "disconnect":
+		if s.debugger != nil {
+			s.debugger.Pause()
+		}
+		s.respond(request, nil, nil)
+		return false
+	default:
+		s.respond(request, nil, fmt.Errorf("Unsupported request '%s'.", request.Command))
+	}
+	return true
+}
+
+/* Compiles the program being launched against its level. */
+func (s *dapServer) launch(arguments json.RawMessage) error {
+	var args dapLaunch
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	bytes, err := ioutil.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	var rng *rand.Rand
+	if args.Runs > 0 {
+		rng = rand.New(rand.NewSource(args.Seed))
+	}
+	inbox, expected, floor, err := LevelRun(args.Level, rng)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+	debugger, diagnostics := NewDebugger(source, inbox, floor, expected)
+	if len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			s.output(d.Excerpt())
+		}
+		return compileError(diagnostics)
+	}
+	s.debugger = debugger
+	s.path = args.Program
+	s.names = parseAst(source).tileNames()
+	s.stopOnEntry = args.StopOnEntry
+	s.setBreakpoints()
+	return nil
+}
+
+/* Sets the breakpoints last requested by the client, returning them as
+breakpoints for the client. A breakpoint moves to the first instruction
+on or after its line. */
+func (s *dapServer) setBreakpoints() []map[string]interface{} {
+	breakpoints := make([]map[string]interface{}, 0, len(s.lines))
+	if s.debugger != nil {
+		s.interrupt()
+		defer s.run.Unlock()
+		s.debugger.ClearAll()
+	}
+	for _, line := range s.lines {
+		breakpoint := map[string]interface{}{"verified": true, "line": line}
+		if s.debugger != nil {
+			actual, err := s.debugger.Break(strconv.Itoa(line))
+			if err != nil {
+				breakpoint["verified"] = false
+				breakpoint["message"] = err.Error()
+			} else {
+				breakpoint["line"] = actual
+			}
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	return breakpoints
+}
+
+/* Runs the program in the background, so that the client can pause it,
+and reports where it stops. */
+func (s *dapServer) start(run func() Stop) {
+	if s.debugger == nil {
+		return
+	}
+	// Pauses requested before this run are forgotten
+	atomic.StoreInt32(&s.debugger.paused, 0)
+	// The lock is taken before the run starts, so that a request read
+	// next, such as a pause, always finds the program running
+	s.run.Lock()
+	atomic.StoreInt32(&s.running, 1)
+	go func() {
+		defer s.run.Unlock()
+		stop := run()
+		atomic.StoreInt32(&s.running, 0)
+		s.stopped(stop)
+	}()
+}
+
+/* Responds to a request to run the program, and runs it. Like inspecting
+it, running a program which is already running is refused, as the two
+runs would race for the debugger. */
+func (s *dapServer) resume(request dapRequest, body interface{}, run func() Stop) {
+	if s.debugger != nil && atomic.LoadInt32(&s.running) == 1 {
+		s.respond(request, nil, fmt.Errorf("The program is running. Pause it to run it again."))
+		return
+	}
+	s.respond(request, body, nil)
+	s.start(run)
+}
+
+/* Takes control of the debugger, pausing the program if it is running.
+The client is told the program paused, and the caller must unlock run. */
+func (s *dapServer) interrupt() {
+	if atomic.LoadInt32(&s.running) == 1 {
+		s.debugger.Pause()
+	}
+	s.run.Lock()
+}
+
+/* Takes control of the debugger to inspect the stopped program. Requests
+are read on a single goroutine, so rather than wait for a running program,
+which may never stop by itself, and leave a pause unread, an error is
+returned while the program runs. Unless there is an error, the caller must
+unlock run. */
+func (s *dapServer) inspect() error {
+	if s.debugger == nil {
+		return fmt.Errorf("No program has been launched.")
+	}
+	if atomic.LoadInt32(&s.running) == 1 {
+		return fmt.Errorf("The program is running. Pause it to inspect it.")
+	}
+	s.run.Lock()
+	return nil
+}
+
+/* Tells the client why the program stopped. A runtime error stops the
+program like an exception, and it ends once it is run again. */
+func (s *dapServer) stopped(stop Stop) {
+	if stop.Message != "" {
+		s.output(stop.Message)
+	}
+	reason := "step"
+	switch stop.Reason {
+	case STOP_HALT:
+		s.event("terminated", nil)
+		return
+	case STOP_ERROR:
+		if s.failed {
+			s.event("terminated", nil)
+			return
+		}
+		s.failed = true
+		reason = "exception"
+	case STOP_START:
+		reason = "entry"
+	case STOP_BREAKPOINT:
+		reason = "breakpoint"
+	case STOP_WATCH, STOP_CONDITION:
+		reason = "data breakpoint"
+	case STOP_PAUSE:
+		reason = "pause"
+	}
+	s.event("stopped", map[string]interface{}{
+		"reason": reason,
+		"description": stop.Message,
+		"text": stop.Message,
+		"threadId": 1,
+		"allThreadsStopped": true,
+	})
+}
+
+/* Shows a line of text in the client's debug console. */
+func (s *dapServer) output(text string) {
+	s.event("output", map[string]interface{}{"category": "console", "output": text + "\n"})
+}
+
+/* Returns the single stack frame, at the instruction about to run. */
+func (s *dapServer) stackTrace() map[string]interface{} {
+	d := s.debugger
+	name := "HALT"
+	if !d.halted {
+		name = d.instructions[d.current()].String()
+	}
+	frame := map[string]interface{}{
+		"id": 1,
+		"name": name,
+		"line": d.Line(),
+		"column": 1,
+		"source": map[string]interface{}{"name": filepath.Base(s.path), "path": s.path},
+	}
+	return map[string]interface{}{"stackFrames": []interface{}{frame}, "totalFrames": 1}
+}
+
+/* Returns the variables of a scope or list. */
+func (s *dapServer) variables(reference int) []map[string]interface{} {
+	d := s.debugger
+	variables := make([]map[string]interface{}, 0)
+	variable := func(name string, value string, reference int) {
+		variables = append(variables, map[string]interface{}{
+			"name": name,
+			"value": value,
+			"variablesReference": reference,
+		})
+	}
+	switch reference {
+	case DAP_PROGRAM:
+		variable("hand", valueText(d.Hand()), 0)
+		variable("steps", strconv.Itoa(d.Steps()), 0)
+		variable("inbox", valuesText(d.Inbox(), 10), DAP_INBOX)
+		variable("outbox", valuesText(d.Outbox(), 10), DAP_OUTBOX)
+	case DAP_FLOOR:
+		for i, v := range d.Floor() {
+			name := strconv.Itoa(i)
+			if label, ok := s.names[i]; ok {
+				name += " (" + label + ")"
+			}
+			variable(name, valueText(v), 0)
+		}
+	case DAP_INBOX:
+		for i, v := range d.Inbox() {
+			variable(strconv.Itoa(i), valueText(v), 0)
+		}
+	case DAP_OUTBOX:
+		for i, v := range d.Outbox() {
+			variable(strconv.Itoa(i), valueText(v), 0)
+		}
+	}
+	return variables
+}
@@ -0,0 +1,151 @@
+package hrm
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/* A DAP client for tests, which sends requests to a server and reads its
+responses and events in order. */
+type dapClient struct {
+	t *testing.T
+	in *io.PipeWriter
+	messages chan map[string]interface{}
+	seq int
+}
+
+/* Starts a DAP server, returning a client connected to it. */
+func newDapClient(t *testing.T) *dapClient {
+	requests, in := io.Pipe()
+	out, responses := io.Pipe()
+	go ServeDAP(requests, responses)
+	c := &dapClient{t, in, make(chan map[string]interface{}, 16), 0}
+	go func() {
+		reader := bufio.NewReader(out)
+		for {
+			body, err := readMessage(reader)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var message map[string]interface{}
+			json.Unmarshal(body, &message)
+			c.messages <- message
+		}
+	}()
+	return c
+}
+
+/* Sends a request with the given arguments. */
+func (c *dapClient) send(command string, arguments interface{}) {
+	c.seq += 1
+	body, _ := json.Marshal(map[string]interface{}{
+		"seq": c.seq,
+		"type": "request",
+		"command": command,
+		"arguments": arguments,
+	})
+	if err := writeMessage(c.in, body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+/* Waits for the response to a command, or an event, skipping any other
+messages. Fails the test if none arrives within a second. */
+func (c *dapClient) expect(kind string, name string) map[string]interface{} {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case message, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("The server closed before %s '%s'.", kind, name)
+			}
+			if message["type"] == kind && (message["command"] == name || message["event"] == name) {
+				return message
+			}
+		case <-timeout:
+			c.t.Fatalf("Timed out waiting for %s '%s'.", kind, name)
+		}
+	}
+}
+
+/* Launches a program for level 1 which never stops by itself, and
+starts running it. The returned function ends the session. */
+func launchLoop(t *testing.T) (*dapClient, func()) {
+	dir, err := ioutil.TempDir("", "hrm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "01")
+	if err := ioutil.WriteFile(path, []byte("a:\n    JUMP a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newDapClient(t)
+	c.send("initialize", nil)
+	c.expect("event", "initialized")
+	c.send("launch", map[string]interface{}{"program": path, "level": 1})
+	if response := c.expect("response", "launch"); response["success"] != true {
+		t.Fatalf("Launch failed: %v", response["message"])
+	}
+	c.send("configurationDone", nil)
+	c.expect("response", "configurationDone")
+	return c, func() {
+		c.in.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDapInspectWhileRunning(t *testing.T) {
+	c, end := launchLoop(t)
+	defer end()
+	// Inspecting a running program must not stop requests being read
+	c.send("stackTrace", map[string]interface{}{"threadId": 1})
+	if response := c.expect("response", "stackTrace"); response["success"] != false {
+		t.Errorf("Expected stackTrace to fail while running, got %v.", response)
+	}
+	c.send("variables", map[string]interface{}{"variablesReference": DAP_PROGRAM})
+	if response := c.expect("response", "variables"); response["success"] != false {
+		t.Errorf("Expected variables to fail while running, got %v.", response)
+	}
+	// Nor may a second run race the first
+	for _, command := range []string{"continue", "next", "stepIn", "stepBack", "reverseContinue"} {
+		c.send(command, map[string]interface{}{"threadId": 1})
+		if response := c.expect("response", command); response["success"] != false {
+			t.Errorf("Expected %s to fail while running, got %v.", command, response)
+		}
+	}
+	c.send("pause", map[string]interface{}{"threadId": 1})
+	c.expect("response", "pause")
+	c.expect("event", "stopped")
+	c.send("stackTrace", map[string]interface{}{"threadId": 1})
+	if response := c.expect("response", "stackTrace"); response["success"] != true {
+		t.Errorf("Expected stackTrace to succeed once paused, got %v.", response)
+	}
+	c.send("stepIn", map[string]interface{}{"threadId": 1})
+	if response := c.expect("response", "stepIn"); response["success"] != true {
+		t.Errorf("Expected stepIn to succeed once paused, got %v.", response)
+	}
+	c.expect("event", "stopped")
+	c.send("disconnect", nil)
+	c.expect("response", "disconnect")
+}
+
+/* Terminating pauses the program, so that nothing follows the terminated
+event. */
+func TestDapTerminateWhileRunning(t *testing.T) {
+	c, end := launchLoop(t)
+	defer end()
+	c.send("terminate", nil)
+	c.expect("response", "terminate")
+	c.expect("event", "terminated")
+	c.send("stackTrace", map[string]interface{}{"threadId": 1})
+	if response := c.expect("response", "stackTrace"); response["success"] != true {
+		t.Errorf("Expected stackTrace to succeed once terminated, got %v.", response)
+	}
+}
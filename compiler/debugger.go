@@ -0,0 +1,491 @@
+package hrm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/* A debugger runs a program one instruction at a time. Running stops at
+breakpoints, at writes to watched tiles, and when a condition on the hand
+or a tile becomes true. */
+type Debugger struct {
+	vm VM
+	chunk *Chunk
+	instructions []instruction
+	labels map[string]int
+	tiles map[string]int
+	scanner *Scanner
+	inbox Inbox
+	floor Floor
+	expected []Value
+	outbox []Value
+	breakpoints map[int]bool
+	watches map[int]bool
+	conditions []condition
+	history []record
+	recording bool
+	forgotten bool
+	paused int32
+	state INTERPRET_STATE
+	halted bool
+}
+
+/* An enum of the reasons the debugger stopped running a program. */
+type StopReason int
+const (
+	STOP_STEP StopReason = iota
+	STOP_BREAKPOINT
+	STOP_WATCH
+	STOP_CONDITION
+	STOP_HALT
+	STOP_ERROR
+	STOP_START
+	STOP_PAUSE
+)
+
+/* A stop describes why the debugger stopped running a program. */
+type Stop struct {
+	Reason StopReason
+	Message string
+}
+
+/* A condition stops the program when it becomes true. Tile is -1 for a
+condition on the hand. */
+type condition struct {
+	tile int
+	op string
+	value Value
+	text string
+}
+
+/* Compiles the source for debugging against an inbox and floor. The
+outbox is compared with expected when the program finishes, unless
+expected is nil. */
+func NewDebugger(source string, inbox Inbox, floor Floor, expected []Value) (*Debugger, []Diagnostic) {
+	var chunk Chunk
+	chunk.Init()
+	parser := parse(source, &chunk)
+	if len(parser.diagnostics) > 0 {
+		return nil, parser.diagnostics
+	}
+	d := &Debugger{
+		chunk: &chunk,
+		instructions: chunk.code,
+		labels: parser.labels,
+		tiles: parser.tiles,
+		scanner: parser.scanner,
+		inbox: inbox,
+		floor: floor,
+		expected: expected,
+		breakpoints: map[int]bool{},
+		watches: map[int]bool{},
+		recording: true,
+	}
+	d.Restart()
+	return d, nil
+}
+
+/* Runs the program again from the start, with a fresh inbox and floor.
+Breakpoints, watches and conditions are kept. */
+func (d *Debugger) Restart() {
+	d.outbox = make([]Value, 0)
+	d.vm = VM{}
+	d.vm.Init(nil, d.inbox, &d.outbox, append(Floor{}, d.floor...))
+	d.vm.reset(d.chunk)
+	d.state = INTERPRET_OK
+	d.halted = false
+	// A chunk which is not safe to run stops before its first instruction
+	if err := d.chunk.verify(len(d.floor)); err != nil {
+		d.vm.err = err
+		d.state = INTERPRET_RUNTIME_ERROR
+		d.halted = true
+	}
+	d.history = d.history[:0]
+	d.forgotten = false
+	atomic.StoreInt32(&d.paused, 0)
+}
+
+/* Runs a single instruction. */
+func (d *Debugger) Step() Stop {
+	return d.run(func(int) bool { return true })
+}
+
+/* Runs until an instruction further down the program is reached, so
+that a jump back to the start of a loop runs the whole loop. */
+func (d *Debugger) Next() Stop {
+	from := d.current()
+	return d.run(func(i int) bool { return i > from })
+}
+
+/* Runs until a breakpoint, watch or condition stops the program. */
+func (d *Debugger) Continue() Stop {
+	return d.run(func(int) bool { return false })
+}
+
+/* Runs until the instruction at a line or label is reached. */
+func (d *Debugger) RunTo(location string) (Stop, error) {
+	target, err := d.resolve(location)
+	if err != nil {
+		return Stop{}, err
+	}
+	return d.run(func(i int) bool { return i == target }), nil
+}
+
+/* Returns the index of the instruction about to run. */
+func (d *Debugger) current() int {
+	return d.vm.ip
+}
+
+/* Runs instructions until one of them stops the program, or until
+reports true for the index of the instruction about to run. */
+func (d *Debugger) run(until func(int) bool) Stop {
+	if d.halted {
+		return d.finished()
+	}
+	for {
+		if stop, ok := d.instruction(); ok {
+			return stop
+		}
+		if atomic.CompareAndSwapInt32(&d.paused, 1, 0) {
+			return Stop{STOP_PAUSE, "Paused."}
+		}
+		i := d.current()
+		if d.breakpoints[d.vm.ip] {
+			return Stop{STOP_BREAKPOINT, fmt.Sprintf("Breakpoint at line %d.", d.instructions[i].line)}
+		}
+		if until(i) {
+			return Stop{STOP_STEP, ""}
+		}
+	}
+}
+
+/* Runs the instruction about to run. Returns a stop if
+the program finished, or a watch or condition stopped it. */
+func (d *Debugger) instruction() (Stop, bool) {
+	in := d.instructions[d.current()]
+	tile := d.writes(in)
+	var old Value
+	if tile >= 0 {
+		old = d.vm.registers[tile]
+	}
+	before := d.holds()
+	d.record(tile)
+	if state, halted := d.vm.step(); halted {
+		d.state = state
+		d.halted = true
+		return d.finished(), true
+	}
+	if tile >= 0 && d.watches[tile] {
+		return Stop{STOP_WATCH, fmt.Sprintf("Tile %d written by %s: %s -> %s.",
+			tile, in, valueText(old), valueText(d.vm.registers[tile]))}, true
+	}
+	after := d.holds()
+	for i, c := range d.conditions {
+		if after[i] && !before[i] {
+			return Stop{STOP_CONDITION, fmt.Sprintf("Condition %d is true: %s.", i + 1, c.text)}, true
+		}
+	}
+	return Stop{}, false
+}
+
+/* Returns the tile an instruction is about to write, or -1 if it does
+not write a tile or its address is not valid. */
+func (d *Debugger) writes(in instruction) int {
+	switch in.op {
+	case OP_COPYTO, OP_BUMPUP, OP_BUMPDN:
+		return d.address(in)
+	}
+	return -1
+}
+
+/* Returns the tile an instruction uses, resolving indirect addresses
+against the floor. Returns -1 if it uses no tile, or the address is not
+valid. */
+func (d *Debugger) address(in instruction) int {
+	registers := d.vm.registers
+	tile := in.tile
+	if tile >= 0 && in.indirect {
+		if tile >= len(registers) || registers[tile].Type != VAL_INT {
+			return -1
+		}
+		tile = registers[tile].Int
+	}
+	if tile < 0 || tile >= len(registers) {
+		return -1
+	}
+	return tile
+}
+
+/* Returns the stop for a finished program, comparing its outbox. */
+func (d *Debugger) finished() Stop {
+	if d.state == INTERPRET_RUNTIME_ERROR {
+		return Stop{STOP_ERROR, d.vm.err.Error()}
+	}
+	message := fmt.Sprintf("Program finished after %d steps.", d.vm.steps)
+	if d.expected != nil {
+		if err := compareOutbox(d.expected, d.outbox); err != nil {
+			message += " " + err.Error()
+		} else {
+			message += " The outbox is correct."
+		}
+	}
+	return Stop{STOP_HALT, message}
+}
+
+/* Resolves a location to the index of an instruction. A location is
+either a label, or a line number, which resolves to the first instruction
+on or after that line. */
+func (d *Debugger) resolve(location string) (int, error) {
+	if i, ok := d.labels[location]; ok {
+		return i, nil
+	}
+	line, err := strconv.Atoi(location)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown label '%s'.", location)
+	}
+	for i, in := range d.instructions {
+		if in.line >= line && in.op != OP_HALT {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("No instruction on or after line %d.", line)
+}
+
+/* Sets a breakpoint at a line or label, returning the line of the
+instruction it stops at. */
+func (d *Debugger) Break(location string) (int, error) {
+	i, err := d.resolve(location)
+	if err != nil {
+		return 0, err
+	}
+	d.breakpoints[i] = true
+	return d.instructions[i].line, nil
+}
+
+/* Removes every breakpoint. */
+func (d *Debugger) ClearAll() {
+	d.breakpoints = map[int]bool{}
+}
+
+/* Stops the program after the instruction being run, if it is running.
+Pause may be called while another goroutine is running the program. */
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.paused, 1)
+}
+
+/* Removes a breakpoint from a line or label. */
+func (d *Debugger) Clear(location string) error {
+	i, err := d.resolve(location)
+	if err != nil {
+		return err
+	}
+	if !d.breakpoints[i] {
+		return fmt.Errorf("No breakpoint at %s.", location)
+	}
+	delete(d.breakpoints, i)
+	return nil
+}
+
+/* Returns the lines which have breakpoints, in order. */
+func (d *Debugger) Breakpoints() []int {
+	lines := make([]int, 0)
+	for i, in := range d.instructions {
+		if d.breakpoints[i] {
+			lines = append(lines, in.line)
+		}
+	}
+	return lines
+}
+
+/* Stops the program whenever a tile is written. */
+func (d *Debugger) Watch(tile int) error {
+	if tile < 0 || tile >= len(d.floor) {
+		return fmt.Errorf(NO_TILE_ERROR, len(d.floor))
+	}
+	d.watches[tile] = true
+	return nil
+}
+
+/* Stops watching a tile. */
+func (d *Debugger) Unwatch(tile int) error {
+	if !d.watches[tile] {
+		return fmt.Errorf("Tile %d is not watched.", tile)
+	}
+	delete(d.watches, tile)
+	return nil
+}
+
+/* Returns the watched tiles, in order. */
+func (d *Debugger) Watches() []int {
+	tiles := make([]int, 0)
+	for tile := range d.floor {
+		if d.watches[tile] {
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles
+}
+
+/* Stops the program when a condition becomes true. A condition compares
+the hand or a tile with a value, such as "hand == 0" or "3 < -5". */
+func (d *Debugger) BreakIf(text string) error {
+	fields := strings.Fields(text)
+	if len(fields) != 3 {
+		return fmt.Errorf("Expected a condition like 'hand == 0' or '3 > A'.")
+	}
+	c := condition{tile: -1, op: fields[1], text: strings.Join(fields, " ")}
+	if fields[0] != "hand" {
+		tile, err := d.Tile(fields[0])
+		if err != nil || tile < 0 || tile >= len(d.floor) {
+			return fmt.Errorf("Expected 'hand' or a tile on the floor, not '%s'.", fields[0])
+		}
+		c.tile = tile
+	}
+	switch c.op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return fmt.Errorf("Unknown comparison '%s'.", c.op)
+	}
+	value, err := parseValue(fields[2])
+	if err != nil {
+		return err
+	}
+	c.value = value
+	d.conditions = append(d.conditions, c)
+	return nil
+}
+
+/* Removes a condition by its number, counting from 1. */
+func (d *Debugger) RemoveCondition(n int) error {
+	if n < 1 || n > len(d.conditions) {
+		return fmt.Errorf("No condition %d.", n)
+	}
+	d.conditions = append(d.conditions[:n - 1], d.conditions[n:]...)
+	return nil
+}
+
+/* Returns the conditions, in the order they were added. */
+func (d *Debugger) Conditions() []string {
+	texts := make([]string, 0, len(d.conditions))
+	for _, c := range d.conditions {
+		texts = append(texts, c.text)
+	}
+	return texts
+}
+
+/* Returns whether each condition currently holds. */
+func (d *Debugger) holds() []bool {
+	holds := make([]bool, len(d.conditions))
+	for i, c := range d.conditions {
+		value := d.vm.hand
+		if c.tile >= 0 {
+			value = d.vm.registers[c.tile]
+		}
+		holds[i] = c.holds(value)
+	}
+	return holds
+}
+
+/* Checks whether a value satisfies the condition. Only values of the
+same type are ordered, and an empty value never satisfies a condition. */
+func (c condition) holds(value Value) bool {
+	switch {
+	case value.Type == VAL_EMPTY:
+		return false
+	case c.op == "==":
+		return value == c.value
+	case c.op == "!=":
+		return value != c.value
+	case value.Type != c.value.Type:
+		return false
+	}
+	cmp := compareValues(value, c.value)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+/* Parses a value as written by a person: a number, or a single letter. */
+func parseValue(text string) (Value, error) {
+	if i, err := strconv.Atoi(text); err == nil {
+		return IntVal(i), nil
+	}
+	if len(text) == 1 && isAlpha(text[0]) {
+		return CharVal(rune(text[0])), nil
+	}
+	return Value{}, fmt.Errorf("Expected a number or a letter, not '%s'.", text)
+}
+
+/* Returns the tile given by a number, or by a name from a TILE
+declaration. */
+func (d *Debugger) Tile(text string) (int, error) {
+	if tile, ok := d.tiles[text]; ok {
+		return tile, nil
+	}
+	tile, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("Expected a tile number or name, not '%s'.", text)
+	}
+	return tile, nil
+}
+
+/* Formats a value as the game shows it. Empty values are shown as '.'. */
+func valueText(v Value) string {
+	switch v.Type {
+	case VAL_INT:
+		return strconv.Itoa(v.Int)
+	case VAL_CHAR:
+		return string(v.Char)
+	case VAL_EMPTY:
+		return "."
+	}
+	return v.String()
+}
+
+/* Returns the line of the instruction about to run, or of the last
+instruction run once the program has finished. */
+func (d *Debugger) Line() int {
+	if d.halted {
+		return d.instructions[d.vm.current].line
+	}
+	return d.instructions[d.current()].line
+}
+
+/* Returns whether the program has finished running. */
+func (d *Debugger) Halted() bool {
+	return d.halted
+}
+
+/* Returns the number of steps run so far. */
+func (d *Debugger) Steps() int {
+	return d.vm.steps
+}
+
+/* Returns the value held, which is empty if nothing is held. */
+func (d *Debugger) Hand() Value {
+	return d.vm.hand
+}
+
+/* Returns the values left in the inbox. */
+func (d *Debugger) Inbox() []Value {
+	return d.vm.inbox
+}
+
+/* Returns the values sent to the outbox so far. */
+func (d *Debugger) Outbox() []Value {
+	return d.outbox
+}
+
+/* Returns the tiles on the floor. */
+func (d *Debugger) Floor() Floor {
+	return d.vm.registers
+}
@@ -0,0 +1,105 @@
+package hrm
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+/* Starts a debugger on the solution to level 20, which multiplies pairs
+of numbers, with the pairs 3 × 2 and 0 × 5. */
+func newLevelDebugger(t *testing.T, inbox Inbox) *Debugger {
+	source, err := ioutil.ReadFile("../levels/20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	floor, err := LevelFloor(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inbox == nil {
+		inbox = Inbox{IntVal(3), IntVal(2), IntVal(0), IntVal(5)}
+	}
+	d, diagnostics := NewDebugger(string(source), inbox, floor, []Value{IntVal(6), IntVal(0)})
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	return d
+}
+
+/* Checks why the debugger stopped, and where. */
+func expectStop(t *testing.T, d *Debugger, stop Stop, reason StopReason, ip int, steps int) {
+	t.Helper()
+	if stop.Reason != reason {
+		t.Fatalf("Expected stop %d, got %+v.", reason, stop)
+	}
+	if d.current() != ip || d.Steps() != steps {
+		t.Errorf("Expected to stop at instruction %d after %d steps, got %d after %d.", ip, steps, d.current(), d.Steps())
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	d := newLevelDebugger(t, nil)
+	if line, err := d.Break("16"); err != nil || line != 16 {
+		t.Fatalf("Expected a breakpoint on line 16, got %d, %v.", line, err)
+	}
+	if line, err := d.Break("answer"); err != nil || line != 5 {
+		t.Fatalf("Expected a breakpoint on line 5, got %d, %v.", line, err)
+	}
+	expectStop(t, d, d.Continue(), STOP_BREAKPOINT, 9, 7)
+	if d.Line() != 16 {
+		t.Errorf("Expected to stop on line 16, got %d.", d.Line())
+	}
+	// The loop runs once more before the product is sent
+	expectStop(t, d, d.Continue(), STOP_BREAKPOINT, 9, 13)
+	expectStop(t, d, d.Continue(), STOP_BREAKPOINT, 1, 15)
+	if d.Line() != 5 {
+		t.Errorf("Expected to stop on line 5, got %d.", d.Line())
+	}
+}
+
+func TestDebuggerWatch(t *testing.T) {
+	d := newLevelDebugger(t, nil)
+	if err := d.Watch(0); err != nil {
+		t.Fatal(err)
+	}
+	stop := d.Continue()
+	expectStop(t, d, stop, STOP_WATCH, 5, 3)
+	if stop.Message != "Tile 0 written by COPYTO 0: . -> 3." {
+		t.Errorf("Unexpected message %q.", stop.Message)
+	}
+	stop = d.Continue()
+	expectStop(t, d, stop, STOP_WATCH, 14, 12)
+	if stop.Message != "Tile 0 written by COPYTO 0: 3 -> 6." {
+		t.Errorf("Unexpected message %q.", stop.Message)
+	}
+}
+
+func TestDebuggerCondition(t *testing.T) {
+	d := newLevelDebugger(t, nil)
+	if err := d.BreakIf("hand == 0"); err != nil {
+		t.Fatal(err)
+	}
+	// BUMPDN counts tile 9 down to 0
+	stop := d.Continue()
+	expectStop(t, d, stop, STOP_CONDITION, 10, 14)
+	if stop.Message != "Condition 1 is true: hand == 0." {
+		t.Errorf("Unexpected message %q.", stop.Message)
+	}
+	// The hand holds 6 and is then emptied before 0 is taken from the inbox
+	expectStop(t, d, d.Continue(), STOP_CONDITION, 4, 18)
+}
+
+func TestDebuggerFinish(t *testing.T) {
+	d := newLevelDebugger(t, nil)
+	stop := d.Continue()
+	if stop.Reason != STOP_HALT || !strings.HasSuffix(stop.Message, "The outbox is correct.") || !d.Halted() {
+		t.Errorf("Expected the program to finish, got %+v.", stop)
+	}
+	// A letter cannot be multiplied
+	d = newLevelDebugger(t, Inbox{CharVal('A'), IntVal(2)})
+	stop = d.Continue()
+	if stop.Reason != STOP_ERROR || d.Line() != 19 {
+		t.Errorf("Expected an error on line 19, got %+v on line %d.", stop, d.Line())
+	}
+}
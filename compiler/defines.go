@@ -0,0 +1,198 @@
+package hrm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* An enum of the kinds of DEFINE blocks. A comment is a drawing placed
+among the instructions, and a label is a drawing on a tile of the floor. */
+type DefineKind int
+const (
+	DEFINE_COMMENT DefineKind = iota
+	DEFINE_LABEL
+)
+func (k DefineKind) String() string {
+	switch k {
+	case DEFINE_COMMENT:
+		return "COMMENT"
+	case DEFINE_LABEL:
+		return "LABEL"
+	}
+	return fmt.Sprintf("<DefineKind %d?>", int(k))
+}
+
+/* A point of a drawing. Both coordinates range from 0 to 65535, and the
+point (0, 0) lifts the pen between strokes. */
+type Point struct {
+	X int
+	Y int
+}
+
+/* A definition is a DEFINE COMMENT or DEFINE LABEL block. Index is the
+comment number, or the tile a label is drawn on. Data is the base64 of the
+drawing, and Points its decoded coordinates, which are nil if the data
+could not be decoded. Name is taken from a "-- name --" comment on the
+line before the block, as the solutions in levels/ do. */
+type Definition struct {
+	Kind DefineKind
+	Index int
+	Name string
+	Data string
+	Points []Point
+	Line int
+}
+
+/* A COMMENT n instruction, linked to the DEFINE COMMENT block drawing
+it. Definition is nil if the program does not define the comment. */
+type Comment struct {
+	Index int
+	Line int
+	Definition *Definition
+	token Token
+}
+
+/* Parses a DEFINE block, from DEFINE up to and including the ';'. The
+base64 may be split over several lines, which are joined. A block without
+a ';' is an error. The comment is
+the line comment before the block, if any. */
+func (p *Parser) define(token Token, comment Token) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(token.Literal), ";"))
+	definition := Definition{Line: token.line}
+	invalid := func(err string) {
+		header := token
+		header.Literal = "DEFINE"
+		p.raiseSkipped(header, ERR_EXPECTED_TOKEN, err)
+	}
+	switch {
+	case !strings.HasSuffix(strings.TrimSpace(token.Literal), ";"):
+		// Without a ';' the block runs to the end of the source
+		invalid("Expected ';' at the end of the DEFINE block.")
+		return
+	case len(fields) > 1 && fields[1] == "COMMENT":
+		definition.Kind = DEFINE_COMMENT
+	case len(fields) > 1 && fields[1] == "LABEL":
+		definition.Kind = DEFINE_LABEL
+	default:
+		invalid("Expected COMMENT or LABEL after DEFINE.")
+		return
+	}
+	index := -1
+	if len(fields) > 2 {
+		if n, err := strconv.Atoi(fields[2]); err == nil {
+			index = n
+		}
+	}
+	if index < 0 {
+		invalid(fmt.Sprintf("Expected a number after 'DEFINE %s'.", definition.Kind))
+		return
+	}
+	definition.Index = index
+	definition.Data = strings.Join(fields[3:], "")
+	definition.Points, _ = decodeDrawing(definition.Data)
+	if comment.Type == LINE_COMMENT && comment.line == token.line - 1 {
+		text := strings.TrimSpace(comment.Literal)
+		if strings.HasSuffix(text, "--") && len(text) > 4 {
+			definition.Name = strings.TrimSpace(text[2:len(text) - 2])
+		}
+	}
+	p.definitions = append(p.definitions, definition)
+	p.skipped = append(p.skipped, Node{Type: NODE_DEFINE, Value: index, Span: tokenSpan(token)})
+}
+
+/* Gives each DEFINE node its definition, and links each COMMENT n
+instruction to the last DEFINE COMMENT n block. */
+func (p *Parser) link() {
+	p.ast.Definitions = p.definitions
+	defines := 0
+	for i := range p.ast.Nodes {
+		node := &p.ast.Nodes[i]
+		switch node.Type {
+		case NODE_DEFINE:
+			node.Definition = &p.definitions[defines]
+			defines += 1
+		case NODE_COMMENT:
+			node.Definition = p.commentDefinition(node.Value)
+		}
+	}
+	for i := range p.comments {
+		p.comments[i].Definition = p.commentDefinition(p.comments[i].Index)
+	}
+}
+
+/* Returns the last DEFINE COMMENT block for a comment, or nil if there is
+none. */
+func (p *Parser) commentDefinition(index int) *Definition {
+	var definition *Definition
+	for i := range p.definitions {
+		if d := &p.definitions[i]; d.Kind == DEFINE_COMMENT && d.Index == index {
+			definition = d
+		}
+	}
+	return definition
+}
+
+/* Decodes the base64 of a drawing. The data is zlib compressed, and holds
+the number of points followed by the coordinates of each, all little
+endian. */
+func decodeDrawing(data string) ([]Point, error) {
+	compressed, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	if err != nil {
+		return nil, err
+	}
+	z, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadAll(z)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 4 {
+		return nil, fmt.Errorf("Drawing is missing its number of points.")
+	}
+	count := int(binary.LittleEndian.Uint32(raw))
+	if len(raw) < 4 + 4 * count {
+		return nil, fmt.Errorf("Drawing has %d points, but only holds %d.", count, (len(raw) - 4) / 4)
+	}
+	points := make([]Point, count)
+	for i := range points {
+		offset := 4 + 4 * i
+		points[i].X = int(binary.LittleEndian.Uint16(raw[offset:]))
+		points[i].Y = int(binary.LittleEndian.Uint16(raw[offset + 2:]))
+	}
+	return points, nil
+}
+
+/* Returns the names of the tiles named by TILE declarations, or given a
+DEFINE LABEL block, in the source parsed. Labelled tiles without a
+"-- name --" comment above them are named "label". */
+func (p *Parser) tileNames() map[int]string {
+	names := map[int]string{}
+	for _, d := range p.definitions {
+		if d.Kind != DEFINE_LABEL {
+			continue
+		}
+		names[d.Index] = "label"
+		if d.Name != "" {
+			names[d.Index] = d.Name
+		}
+	}
+	// A tile with several names is shown by the first in alphabetical order
+	aliases := make([]string, 0, len(p.tiles))
+	for name := range p.tiles {
+		aliases = append(aliases, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(aliases)))
+	for _, name := range aliases {
+		names[p.tiles[name]] = name
+	}
+	return names
+}
@@ -0,0 +1,63 @@
+package hrm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The base64 of a drawing of the points (10, 20), (300, 400) and (0, 0)
+const DRAWING = "eJxjZmBg4GIQYdBhnMAIZDIAAAZMAOA"
+
+var DRAWING_POINTS = []Point{{10, 20}, {300, 400}, {0, 0}}
+
+func TestDefines(t *testing.T) {
+	source := "    COMMENT 0\n    INBOX\n    OUTBOX\n-- wave --\nDEFINE COMMENT 0\n" +
+		DRAWING[:16] + "\n" + DRAWING[16:] + ";\nDEFINE LABEL 3\n" + DRAWING + ";\n"
+	ast, diagnostics := Parse(source)
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	expected := []Definition{
+		{DEFINE_COMMENT, 0, "wave", DRAWING, DRAWING_POINTS, 5},
+		{DEFINE_LABEL, 3, "", DRAWING, DRAWING_POINTS, 8},
+	}
+	if !reflect.DeepEqual(ast.Definitions, expected) {
+		t.Errorf("Expected %+v, got %+v.", expected, ast.Definitions)
+	}
+	if d := ast.Nodes[0].Definition; d == nil || d.Name != "wave" {
+		t.Errorf("Expected COMMENT 0 to be linked to its DEFINE block, got %+v.", d)
+	}
+}
+
+func TestDecodeDrawing(t *testing.T) {
+	if points, err := decodeDrawing(DRAWING); err != nil || !reflect.DeepEqual(points, DRAWING_POINTS) {
+		t.Errorf("Expected %v, got %v, %v.", DRAWING_POINTS, points, err)
+	}
+	bad := []struct {
+		name string
+		data string
+	}{
+		{"Base64", "eJx!jZmBg"},
+		// "hello world", which is not compressed
+		{"Zlib", "aGVsbG8gd29ybGQ"},
+		// Claims 5 points, but holds 1
+		{"Truncated", "eJxjZWBgYGRgYgAAADgACQ"},
+	}
+	for _, test := range bad {
+		if points, err := decodeDrawing(test.data); err == nil {
+			t.Errorf("%s: expected an error, got %v.", test.name, points)
+		}
+		// A drawing which cannot be decoded still compiles
+		ast, diagnostics := Parse("DEFINE COMMENT 1\n" + test.data + ";\n")
+		if len(diagnostics) > 0 || len(ast.Definitions) != 1 || ast.Definitions[0].Points != nil {
+			t.Errorf("%s: expected a definition without points, got %+v, %v.", test.name, ast.Definitions, diagnostics)
+		}
+	}
+}
+
+func TestUnterminatedDefine(t *testing.T) {
+	_, diagnostics := Parse("    INBOX\nDEFINE LABEL 0\n" + DRAWING + "\n    OUTBOX\n")
+	if len(diagnostics) != 1 || diagnostics[0].Kind != ERR_EXPECTED_TOKEN || diagnostics[0].Line != 2 || diagnostics[0].Column != 1 {
+		t.Errorf("Expected a missing ';' on line 2, got %v.", diagnostics)
+	}
+}
@@ -0,0 +1,153 @@
+package hrm
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The random programs are generated from a fixed seed, so that a failure
+// can be reproduced
+const (
+	DIFFERENTIAL_SEED = 1
+	DIFFERENTIAL_PROGRAMS = 10000
+)
+
+/* Checks that the VM and closure backends run programs the same way: the
+same outbox, floor, steps and error. The programs of STEP_COUNTS are run
+with both step modes, then random programs against random floors and
+inboxes. */
+func TestBackends(t *testing.T) {
+	for i, test := range STEP_COUNTS {
+		floor, _ := LevelFloor(test.level)
+		program := compileTest(t, test.source)
+		for _, mode := range []StepMode{STEPS_GAME, STEPS_TAKEN_JUMPS} {
+			if err := compareBackends(program, test.inbox, floor, mode); err != nil {
+				t.Errorf("Step count %d (level %d): %s", i + 1, test.level, err)
+			}
+		}
+	}
+	programs := DIFFERENTIAL_PROGRAMS
+	if testing.Short() {
+		programs /= 10
+	}
+	rng := rand.New(rand.NewSource(DIFFERENTIAL_SEED))
+	for i := 0; i < programs; i += 1 {
+		floor := randomFloor(rng)
+		source := randomProgram(rng, len(floor))
+		program, diagnostics := Compile(source)
+		if len(diagnostics) > 0 {
+			t.Errorf("Random program %d: %s\n%s", i + 1, compileError(diagnostics), source)
+			continue
+		}
+		mode := StepMode(rng.Intn(2))
+		if err := compareBackends(program, randomInbox(rng), floor, mode); err != nil {
+			t.Errorf("Random program %d: %s\n%s", i + 1, err, source)
+		}
+	}
+}
+
+/* Runs a program on both backends, and describes how the runs differ,
+if they do. */
+func compareBackends(program *Program, inbox Inbox, floor Floor, mode StepMode) error {
+	vm, vmErr := execute(program, inbox, floor, TestConfig{StepMode: mode, Backend: BACKEND_VM})
+	closure, closureErr := execute(program, inbox, floor, TestConfig{StepMode: mode, Backend: BACKEND_CLOSURE})
+	switch {
+	case !reflect.DeepEqual(vmErr, closureErr):
+		return fmt.Errorf("the VM gave error %v, but the closures gave %v.", vmErr, closureErr)
+	case !reflect.DeepEqual(vm.Outbox, closure.Outbox):
+		return fmt.Errorf("the VM gave outbox %v, but the closures gave %v.", vm.Outbox, closure.Outbox)
+	case !reflect.DeepEqual(vm.Floor, closure.Floor):
+		return fmt.Errorf("the VM left floor %v, but the closures left %v.", vm.Floor, closure.Floor)
+	case vm.Steps != closure.Steps:
+		return fmt.Errorf("the VM took %d steps, but the closures took %d.", vm.Steps, closure.Steps)
+	}
+	return nil
+}
+
+/* Returns a random value, which is usually a small number so that jumps
+on zero and negatives are taken, and sometimes a letter or a number near
+the limits so that errors are raised. */
+func randomValue(rng *rand.Rand) Value {
+	switch rng.Intn(8) {
+	case 0:
+		return CharVal(rune('A' + rng.Intn(26)))
+	case 1:
+		return IntVal(MIN_VALUE + rng.Intn(MAX_VALUE - MIN_VALUE + 1))
+	}
+	return IntVal(rng.Intn(9) - 4)
+}
+
+/* Returns a random floor of 1 to 8 tiles, some of them empty. */
+func randomFloor(rng *rand.Rand) Floor {
+	floor := make(Floor, 1 + rng.Intn(8))
+	for i := range floor {
+		if rng.Intn(3) > 0 {
+			floor[i] = randomValue(rng)
+		}
+	}
+	return floor
+}
+
+/* Returns a random inbox of up to 8 values. */
+func randomInbox(rng *rand.Rand) Inbox {
+	inbox := make(Inbox, rng.Intn(9))
+	for i := range inbox {
+		inbox[i] = randomValue(rng)
+	}
+	return inbox
+}
+
+/* Returns the source of a random program for a floor of the given size.
+The program is a loop which starts with INBOX, and its other jumps only go
+forward or back to the start, so every program stops once its inbox is
+empty. Addresses are sometimes indirect, and tiles are now and then off
+the floor, so that errors are raised. */
+func randomProgram(rng *rand.Rand, floor int) string {
+	size := 1 + rng.Intn(12)
+	labels := make([]string, size + 1)
+	for i := range labels {
+		if i > 0 && rng.Intn(3) == 0 {
+			labels[i] = fmt.Sprintf("l%d", i)
+		}
+	}
+	var b strings.Builder
+	b.WriteString("a:\n    INBOX\n")
+	for i := 0; i < size; i += 1 {
+		if labels[i] != "" {
+			b.WriteString(labels[i] + ":\n")
+		}
+		switch op := rng.Intn(11); {
+		case op < 2:
+			b.WriteString([]string{"    INBOX\n", "    OUTBOX\n"}[op])
+		case op < 5:
+			// Jump to a later label, or back to the start
+			target := "a"
+			for j := i + 1; j < len(labels); j += 1 {
+				if labels[j] != "" && rng.Intn(2) == 0 {
+					target = labels[j]
+					break
+				}
+			}
+			b.WriteString(fmt.Sprintf("    %s %s\n", []string{"JUMP", "JUMPZ", "JUMPN"}[op - 2], target))
+		default:
+			name := []string{"COPYFROM", "COPYTO", "ADD", "SUB", "BUMPUP", "BUMPDN"}[op - 5]
+			tile := rng.Intn(floor)
+			if rng.Intn(50) == 0 {
+				tile = floor
+			}
+			if rng.Intn(4) == 0 {
+				b.WriteString(fmt.Sprintf("    %s [%d]\n", name, tile))
+			} else {
+				b.WriteString(fmt.Sprintf("    %s %d\n", name, tile))
+			}
+		}
+	}
+	if labels[size] != "" {
+		b.WriteString(labels[size] + ":\n")
+	}
+	b.WriteString("    JUMP a\n")
+	return b.String()
+}
@@ -0,0 +1,303 @@
+package hrm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* The start of every generated C program: the value model and the state
+of the VM, apart from the floor. */
+const C_PRELUDE = `#include <ctype.h>
+#include <stdarg.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+enum { VAL_EMPTY, VAL_INT, VAL_CHAR };
+
+typedef struct {
+	int type;
+	int value;
+} Value;
+
+static Value hand;
+static long long steps;
+static Value *inbox;
+static size_t inbox_len, inbox_pos;
+`
+
+/* The helpers of every generated C program, which follow the floor.
+Errors are raised with the messages of the VM, and values are checked in
+the same order, so that the same error wins. */
+const C_HELPERS = `/* Prints the number of steps taken, and exits. */
+static void finish(int status) {
+	fflush(stdout);
+	fprintf(stderr, "Steps: %lld\n", steps);
+	exit(status);
+}
+
+/* Raises a runtime error at a source line. */
+static void fail(int line, const char *format, ...) {
+	va_list args;
+	fflush(stdout);
+	fprintf(stderr, "[Ln %d] Runtime Error: ", line);
+	va_start(args, format);
+	vfprintf(stderr, format, args);
+	va_end(args);
+	fputc('\n', stderr);
+	finish(1);
+}
+
+/* Reads the inbox from stdin: numbers, or single letters, separated by
+whitespace. */
+static void read_inbox(void) {
+	char token[64];
+	size_t cap = 64;
+	inbox = malloc(cap * sizeof(Value));
+	inbox_pos = 0;
+	while (scanf("%63s", token) == 1) {
+		char *end;
+		long n = strtol(token, &end, 10);
+		Value v;
+		if (end != token && *end == '\0') {
+			v.type = VAL_INT;
+			v.value = (int)n;
+		} else if (isalpha((unsigned char)token[0]) && token[1] == '\0') {
+			v.type = VAL_CHAR;
+			v.value = token[0];
+		} else {
+			fprintf(stderr, "Bad inbox value '%s'. Values are numbers or single letters.\n", token);
+			exit(2);
+		}
+		if (inbox_len == cap) {
+			cap *= 2;
+			inbox = realloc(inbox, cap * sizeof(Value));
+		}
+		inbox[inbox_len++] = v;
+	}
+}
+
+/* Writes a value to the outbox, one per line. */
+static inline void output(Value v) {
+	if (v.type == VAL_CHAR) {
+		printf("%c\n", v.value);
+	} else {
+		printf("%d\n", v.value);
+	}
+}
+
+static inline Value check_range(int line, int n) {
+	Value v = { VAL_INT, n };
+	if (n < MIN_VALUE || n > MAX_VALUE) {
+		fail(line, OVERFLOW_ERROR);
+	}
+	return v;
+}
+
+static inline Value check_tile(int line, int tile, const char *op) {
+	if (tile < 0 || tile >= FLOOR_SIZE) {
+		fail(line, NO_TILE_ERROR, FLOOR_SIZE);
+	}
+	if (floor_[tile].type == VAL_EMPTY) {
+		fail(line, EMPTY_TILE_ERROR, op);
+	}
+	return floor_[tile];
+}
+
+static inline int deref(int line, int tile) {
+	Value v = check_tile(line, tile, "dereference");
+	if (v.type != VAL_INT) {
+		fail(line, BAD_POINTER_ERROR, v.value);
+	}
+	if (v.value < 0 || v.value >= FLOOR_SIZE) {
+		fail(line, BAD_ADDRESS_ERROR, v.value);
+	}
+	return v.value;
+}
+
+static inline void copy_from(int line, int tile) {
+	hand = check_tile(line, tile, "COPYFROM");
+}
+
+static inline void copy_to(int line, int tile, const char *op) {
+	if (tile < 0 || tile >= FLOOR_SIZE) {
+		fail(line, NO_TILE_ERROR, FLOOR_SIZE);
+	}
+	if (hand.type == VAL_EMPTY) {
+		fail(line, EMPTY_HAND_ERROR, op);
+	}
+	floor_[tile] = hand;
+}
+
+static inline void add(int line, int tile) {
+	Value v = check_tile(line, tile, "ADD");
+	if (hand.type == VAL_EMPTY) {
+		fail(line, EMPTY_HAND_ERROR, "ADD");
+	}
+	if (hand.type != VAL_INT || v.type != VAL_INT) {
+		fail(line, LETTER_ERROR, "ADD");
+	}
+	hand = check_range(line, hand.value + v.value);
+}
+
+static inline void sub(int line, int tile) {
+	Value v = check_tile(line, tile, "SUB");
+	if (hand.type == VAL_EMPTY) {
+		fail(line, EMPTY_HAND_ERROR, "SUB");
+	}
+	if (hand.type == VAL_INT && v.type == VAL_INT) {
+		hand = check_range(line, hand.value - v.value);
+	} else if (hand.type == VAL_CHAR && v.type == VAL_CHAR) {
+		hand.type = VAL_INT;
+		hand.value = hand.value - v.value;
+	} else {
+		fail(line, LETTER_ERROR, "SUB");
+	}
+}
+
+static inline void bump(int line, int tile, int n, const char *op) {
+	Value v = check_tile(line, tile, op);
+	if (v.type != VAL_INT) {
+		fail(line, LETTER_ERROR, op);
+	}
+	hand = check_range(line, v.value + n);
+	copy_to(line, tile, op);
+}
+`
+
+/* Returns a Go string as a C string literal. Messages are plain ASCII,
+so quoting them as Go does is valid C. */
+func cString(s string) string {
+	return strconv.Quote(s)
+}
+
+/* Generates a standalone C program which runs a compiled program like the
+VM: the same values, errors and step counting. The program reads its inbox
+from stdin, writes its outbox to stdout one value per line, and writes the
+steps taken and any error to stderr. It exits with 1 on a runtime error.
+The floor is compiled in. If it is nil, the floor has as many empty tiles
+as the program needs, up to the largest floor in the game. */
+func EmitC(program *Program, floor Floor, mode StepMode) string {
+	code := program.chunk.code
+	indirect := false
+	tiles := 0
+	for _, in := range code {
+		indirect = indirect || in.indirect
+		if in.tile >= tiles {
+			tiles = in.tile + 1
+		}
+	}
+	if floor == nil {
+		// A tile off the largest floor fails when the program is verified
+		if tiles > MAX_FLOOR {
+			tiles = MAX_FLOOR
+		}
+		floor = make(Floor, tiles)
+	}
+	var b strings.Builder
+	b.WriteString("/* Generated by hrm emit-c. */\n\n")
+	fmt.Fprintf(&b, "#define MIN_VALUE %d\n", MIN_VALUE)
+	fmt.Fprintf(&b, "#define MAX_VALUE %d\n", MAX_VALUE)
+	fmt.Fprintf(&b, "#define FLOOR_SIZE %d\n", len(floor))
+	for _, message := range [][2]string{
+		{"EMPTY_TILE_ERROR", EMPTY_TILE_ERROR},
+		{"EMPTY_HAND_ERROR", EMPTY_HAND_ERROR},
+		{"NO_TILE_ERROR", NO_TILE_ERROR},
+		{"BAD_ADDRESS_ERROR", BAD_ADDRESS_ERROR},
+		// Only letters can be bad pointers, as empty tiles fail first
+		{"BAD_POINTER_ERROR", strings.Replace(BAD_POINTER_ERROR, "%v", "<Char %c>", 1)},
+		{"OVERFLOW_ERROR", OVERFLOW_ERROR},
+		{"LETTER_ERROR", LETTER_ERROR},
+	} {
+		fmt.Fprintf(&b, "#define %s %s\n", message[0], cString(message[1]))
+	}
+	b.WriteString("\n")
+	b.WriteString(C_PRELUDE)
+	b.WriteString("\n/* The floor, with a spare tile so that it is never empty. */\n")
+	b.WriteString("static Value floor_[FLOOR_SIZE + 1] = {")
+	for i, v := range floor {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		switch v.Type {
+		case VAL_INT:
+			fmt.Fprintf(&b, " { VAL_INT, %d }", v.Int)
+		case VAL_CHAR:
+			fmt.Fprintf(&b, " { VAL_CHAR, '%c' }", v.Char)
+		default:
+			b.WriteString(" { VAL_EMPTY, 0 }")
+		}
+	}
+	b.WriteString(" };\n\n")
+	b.WriteString(C_HELPERS)
+	b.WriteString("\nint main(void) {\n")
+	b.WriteString("\tread_inbox();\n")
+	if err := program.chunk.verify(len(floor)); err != nil {
+		// The VM would not run the program at all, so its instructions
+		// are left out, as their tiles may not even fit in an int
+		fmt.Fprintf(&b, "\tfail(%d, \"%%s\", %s);\n}\n", err.Line, cString(err.Message))
+		return b.String()
+	}
+	if indirect {
+		b.WriteString("\tint tile;\n")
+	}
+	targets := map[int]bool{}
+	for _, in := range code {
+		if in.target >= 0 {
+			targets[in.target] = true
+		}
+	}
+	// Untaken jumps are only steps in the game's count
+	untaken := "\t} else {\n\t\tsteps += 1;\n\t}\n"
+	if mode == STEPS_TAKEN_JUMPS {
+		untaken = "\t}\n"
+	}
+	for i, in := range code {
+		if targets[i] {
+			fmt.Fprintf(&b, "i%d:\n", i)
+		}
+		if in.target >= 0 {
+			fmt.Fprintf(&b, "\t/* %s i%d */\n", in, in.target)
+		} else {
+			fmt.Fprintf(&b, "\t/* %s */\n", in)
+		}
+		tile := strconv.Itoa(in.tile)
+		if in.indirect {
+			fmt.Fprintf(&b, "\ttile = deref(%d, %d);\n", in.line, in.tile)
+			tile = "tile"
+		}
+		switch in.op {
+		case OP_HALT:
+			b.WriteString("\tfinish(0);\n")
+		case OP_INBOX:
+			b.WriteString("\tif (inbox_pos == inbox_len) {\n\t\tfinish(0);\n\t}\n")
+			b.WriteString("\thand = inbox[inbox_pos++];\n\tsteps += 1;\n")
+		case OP_OUTBOX:
+			fmt.Fprintf(&b, "\tif (hand.type == VAL_EMPTY) {\n\t\tfail(%d, EMPTY_HAND_ERROR, \"OUTBOX\");\n\t}\n", in.line)
+			b.WriteString("\toutput(hand);\n\thand.type = VAL_EMPTY;\n\tsteps += 1;\n")
+		case OP_JUMP:
+			fmt.Fprintf(&b, "\tsteps += 1;\n\tgoto i%d;\n", in.target)
+		case OP_JUMPZ, OP_JUMPN:
+			test := "hand.value == 0"
+			if in.op == OP_JUMPN {
+				test = "hand.value < 0"
+			}
+			fmt.Fprintf(&b, "\tif (hand.type == VAL_INT && %s) {\n\t\tsteps += 1;\n\t\tgoto i%d;\n%s",
+				test, in.target, untaken)
+		case OP_COPYFROM:
+			fmt.Fprintf(&b, "\tcopy_from(%d, %s);\n\tsteps += 1;\n", in.line, tile)
+		case OP_COPYTO:
+			fmt.Fprintf(&b, "\tcopy_to(%d, %s, \"COPYTO\");\n\tsteps += 1;\n", in.line, tile)
+		case OP_ADD:
+			fmt.Fprintf(&b, "\tadd(%d, %s);\n\tsteps += 1;\n", in.line, tile)
+		case OP_SUB:
+			fmt.Fprintf(&b, "\tsub(%d, %s);\n\tsteps += 1;\n", in.line, tile)
+		case OP_BUMPUP:
+			fmt.Fprintf(&b, "\tbump(%d, %s, 1, \"BUMP+\");\n\tsteps += 1;\n", in.line, tile)
+		case OP_BUMPDN:
+			fmt.Fprintf(&b, "\tbump(%d, %s, -1, \"BUMP-\");\n\tsteps += 1;\n", in.line, tile)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package hrm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The levels whose solutions are compiled to C and checked against Run
+var EMIT_C_LEVELS = []int{4, 20, 28, 36, 41}
+
+/* Programs which fail with a runtime error, with the inbox that fails
+them. */
+var EMIT_C_ERRORS = []struct {
+	name string
+	source string
+	inbox Inbox
+}{
+	{"AddLetters", "    INBOX\n    COPYTO 0\n    INBOX\n    ADD 0\n    OUTBOX\n", Inbox{CharVal('A'), CharVal('B')}},
+	{"SubLetterNumber", "    INBOX\n    COPYTO 0\n    INBOX\n    SUB 0\n    OUTBOX\n", Inbox{IntVal(3), CharVal('B')}},
+	{"BumpLetter", "    INBOX\n    COPYTO 0\n    BUMPUP 0\n    OUTBOX\n", Inbox{CharVal('C')}},
+	{"Overflow", "a:\n    INBOX\n    COPYTO 0\n    ADD 0\n    OUTBOX\n    JUMP a\n", Inbox{IntVal(400), IntVal(500)}},
+}
+
+/* Compiles the C emitted for a program with cc, runs it on an inbox, and
+checks that its outbox, steps and error are those of Run. */
+func compareEmitC(t *testing.T, dir string, program *Program, inbox Inbox, floor Floor, mode StepMode) {
+	t.Helper()
+	source := filepath.Join(dir, "program.c")
+	binary := filepath.Join(dir, "program")
+	if err := ioutil.WriteFile(source, []byte(EmitC(program, floor, mode)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("cc", "-O1", "-o", binary, source).CombinedOutput(); err != nil {
+		t.Fatalf("cc failed: %v\n%s", err, out)
+	}
+	values := make([]string, len(inbox))
+	for i, v := range inbox {
+		values[i] = valueText(v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary)
+	cmd.Stdin = strings.NewReader(strings.Join(values, " "))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	result, err := execute(program, inbox, floor, TestConfig{StepMode: mode})
+	expected := ""
+	for _, v := range result.Outbox {
+		expected += valueText(v) + "\n"
+	}
+	if stdout.String() != expected {
+		t.Errorf("Expected the outbox\n%sgot\n%s", expected, stdout.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if steps := fmt.Sprintf("Steps: %d", result.Steps); lines[len(lines) - 1] != steps {
+		t.Errorf("Expected %q, got %q.", steps, lines[len(lines) - 1])
+	}
+	switch {
+	case err == nil && runErr != nil:
+		t.Errorf("Expected no error, got %v: %s", runErr, stderr.String())
+	case err != nil && (len(lines) < 2 || lines[0] != err.Error()):
+		t.Errorf("Expected the error %q, got %q.", err.Error(), stderr.String())
+	}
+}
+
+func TestEmitC(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("No C compiler.")
+	}
+	dir, err := ioutil.TempDir("", "hrm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rng := rand.New(rand.NewSource(1))
+	for _, mode := range []StepMode{STEPS_GAME, STEPS_TAKEN_JUMPS} {
+		for _, level := range EMIT_C_LEVELS {
+			source, err := ioutil.ReadFile(fmt.Sprintf("../levels/%02d", level))
+			if err != nil {
+				t.Fatal(err)
+			}
+			inbox, _, floor, err := LevelRun(level, rng)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Run(fmt.Sprintf("Level%d/%d", level, mode), func(t *testing.T) {
+				compareEmitC(t, dir, compileTest(t, string(source)), inbox, floor, mode)
+			})
+		}
+		for _, test := range EMIT_C_ERRORS {
+			t.Run(fmt.Sprintf("%s/%d", test.name, mode), func(t *testing.T) {
+				program := compileTest(t, test.source)
+				if _, err := Run(program, test.inbox, make(Floor, 1)); err == nil {
+					t.Fatal("Expected the program to fail.")
+				}
+				compareEmitC(t, dir, program, test.inbox, make(Floor, 1), mode)
+			})
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package hrm
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* An enum of the kinds of errors which can be raised while compiling,
+running or checking a program. */
+type ErrorKind int
+const (
+	// Compile errors
+	ERR_UNEXPECTED_CHARACTER ErrorKind = iota
+	ERR_UNEXPECTED_TOKEN
+	ERR_EXPECTED_TOKEN
+	ERR_UNKNOWN_LABEL
+	ERR_DUPLICATE_LABEL
+	ERR_UNKNOWN_TILE
+	ERR_DUPLICATE_TILE
+	ERR_OUT_OF_RANGE
+
+	// Runtime errors
+	ERR_EMPTY_TILE
+	ERR_EMPTY_HAND
+	ERR_NOT_A_NUMBER
+	ERR_LETTER
+	ERR_OVERFLOW
+	ERR_NO_TILE
+	ERR_BAD_ADDRESS
+	ERR_BAD_POINTER
+	ERR_UNKNOWN_OPCODE
+
+	// Verify errors, for compiled programs which are not safe to run
+	ERR_BAD_OPERAND
+	ERR_BAD_JUMP
+
+	// Check errors
+	ERR_TOO_MANY_OUTPUTS
+	ERR_TOO_FEW_OUTPUTS
+	ERR_BAD_OUTBOX
+	ERR_UNKNOWN_LEVEL
+
+	// Lint warnings
+	WARN_UNREACHABLE
+	WARN_UNUSED_LABEL
+	WARN_UNREAD_TILE
+	WARN_EMPTY_TILE
+	WARN_EMPTY_HAND
+	WARN_FIXED_JUMP
+	WARN_UNKNOWN_COMMENT
+)
+
+/* An enum of how severe a diagnostic is. Errors stop a program from
+compiling, while warnings do not. */
+type Severity int
+const (
+	SEVERITY_ERROR Severity = iota
+	SEVERITY_WARNING
+)
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_ERROR:
+		return "Error"
+	case SEVERITY_WARNING:
+		return "Warning"
+	default:
+		return fmt.Sprintf("<Severity %d?>", int(s))
+	}
+}
+
+/* Returns the stable code identifying a kind of error, such as E003.
+Lint warnings are numbered separately, such as W002. */
+func (k ErrorKind) Code() string {
+	if k >= WARN_UNREACHABLE {
+		return fmt.Sprintf("W%03d", int(k - WARN_UNREACHABLE) + 1)
+	}
+	return fmt.Sprintf("E%03d", int(k) + 1)
+}
+
+/* A diagnostic is a problem found in the source while compiling. Line and
+Column locate the start of the offending token, which spans Length columns
+of the source line Text. */
+type Diagnostic struct {
+	Line int
+	Column int
+	Length int
+	Kind ErrorKind
+	Severity Severity
+	Message string
+	Text string
+}
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("[Ln %d:%d] %s %s: %s", d.Line, d.Column, d.Severity, d.Kind.Code(), d.Message)
+}
+
+/* Returns the diagnostic followed by an excerpt of its source line, with
+a caret under the offending column. */
+func (d Diagnostic) Excerpt() string {
+	if d.Text == "" {
+		return d.String()
+	}
+	gutter := fmt.Sprintf("%4d | ", d.Line)
+	marker := strings.Repeat(" ", len(gutter) - 2) + "| "
+	// Tabs are kept so the caret lines up with the source line
+	for i := 0; i < d.Column - 1 && i < len(d.Text); i += 1 {
+		if d.Text[i] == '\t' {
+			marker += "\t"
+		} else {
+			marker += " "
+		}
+	}
+	marker += "^"
+	if d.Length > 1 {
+		marker += strings.Repeat("~", d.Length - 1)
+	}
+	return d.String() + "\n" + gutter + d.Text + "\n" + marker
+}
+
+/* A compile error is returned for a program which could not be compiled.
+It holds every diagnostic reported, and describes itself by the first. */
+type CompileError struct {
+	Diagnostic
+	Diagnostics []Diagnostic
+}
+func (e *CompileError) Error() string {
+	return e.Diagnostic.String()
+}
+
+/* Wraps diagnostics in a compile error, or returns nil if there are none. */
+func compileError(diagnostics []Diagnostic) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	return &CompileError{diagnostics[0], diagnostics}
+}
+
+/* A runtime error is raised by the VM when an instruction cannot be
+executed. Line and Column locate the start of the instruction, and Column
+is 0 when the error is at the end of the program rather than at an
+instruction. Tile is -1 when the error does not involve the floor. */
+type RuntimeError struct {
+	Line int
+	Column int
+	Instruction string
+	Tile int
+	Kind ErrorKind
+	Message string
+}
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("[Ln %d] Runtime Error: %s", e.Line, e.Message)
+}
+
+/* An outbox error is raised when a program's outbox does not match the
+outbox expected by a level. Index is the position in the outbox. */
+type OutboxError struct {
+	Index int
+	Expected Value
+	Actual Value
+	Kind ErrorKind
+	Message string
+}
+func (e *OutboxError) Error() string {
+	return e.Message
+}
+
+/* A level error is raised when checking a level which has no test. */
+type LevelError struct {
+	Level int
+	Kind ErrorKind
+}
+func (e *LevelError) Error() string {
+	return fmt.Sprintf("No test written for level %d.", e.Level)
+}
@@ -0,0 +1,133 @@
+package hrm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The first line of a program copied from the game
+const PROGRAM_HEADER = "-- HUMAN RESOURCE MACHINE PROGRAM --"
+
+// The width the game wraps the base64 of a DEFINE block at
+const DEFINE_WIDTH = 80
+
+/* A DEFINE block as it is formatted, with the comments above it. */
+type defineBlock struct {
+	Definition
+	comments []string
+}
+
+/* Formats a program in the layout the game uses for the clipboard: the
+header, one instruction per line indented by four spaces, labels on their
+own lines, and the DEFINE COMMENT and DEFINE LABEL blocks at the end with
+their base64 wrapped at 80 columns. Comments are kept with the line or
+block that follows them. If the source does not compile, the diagnostics
+are returned instead. */
+func Format(source string) (string, []Diagnostic) {
+	return format(source, false)
+}
+
+/* Formats a program like Format, so that it can be pasted into the game.
+Named tiles are replaced by their numbers, and TILE declarations and
+"-- @tile" comments are left out, as the game does not know them. */
+func Export(source string) (string, []Diagnostic) {
+	return format(source, true)
+}
+
+/* Formats a program, exporting it for the game if asked. */
+func format(source string, export bool) (string, []Diagnostic) {
+	ast, diagnostics := Parse(source)
+	if len(diagnostics) > 0 {
+		return "", diagnostics
+	}
+	body := make([]string, 0)
+	blocks := make([]defineBlock, 0)
+	pending := make([]string, 0)
+	// The source line of the last line written, so that a comment after
+	// a statement stays on its line
+	last := 0
+	write := func(line string, node Node) {
+		body = append(body, pending...)
+		body = append(body, line)
+		pending = pending[:0]
+		last = node.Span.EndLine
+	}
+	for _, node := range ast.Nodes {
+		switch {
+		case node.Type == NODE_REMARK, node.Type == NODE_TILE && node.Text != "":
+			switch {
+			case node.Text == PROGRAM_HEADER, node.Type == NODE_TILE && export:
+			case len(body) > 0 && last == node.Span.Line:
+				body[len(body) - 1] += " " + node.Text
+			default:
+				pending = append(pending, node.Text)
+			}
+		case node.Type == NODE_TILE:
+			// Declarations are not instructions, so they are not indented
+			if !export {
+				write(fmt.Sprintf("TILE %s = %d", node.Name, node.Value), node)
+			}
+		case node.Type == NODE_LABEL:
+			write(node.Name + ":", node)
+		case node.Type == NODE_COMMENT:
+			write(fmt.Sprintf("    COMMENT %d", node.Value), node)
+		case node.Type == NODE_EXPRESSION:
+			write(fmt.Sprintf("    %d", node.Value), node)
+		case node.Type == NODE_INSTRUCTION:
+			write("    " + instructionName(node.Op) + operandText(node.Operand, export), node)
+		case node.Type == NODE_DEFINE:
+			blocks = append(blocks, defineBlock{*node.Definition, pending})
+			pending = make([]string, 0)
+		}
+	}
+	body = append(body, pending...)
+	var b strings.Builder
+	b.WriteString(PROGRAM_HEADER + "\n\n")
+	for _, line := range body {
+		b.WriteString(line + "\n")
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Kind != blocks[j].Kind {
+			return blocks[i].Kind < blocks[j].Kind
+		}
+		return blocks[i].Index < blocks[j].Index
+	})
+	for i, block := range blocks {
+		if i == 0 {
+			b.WriteString("\n\n")
+		} else {
+			b.WriteString("\n")
+		}
+		for _, comment := range block.comments {
+			b.WriteString(comment + "\n")
+		}
+		b.WriteString("DEFINE " + block.Kind.String() + " " + strconv.Itoa(block.Index) + "\n")
+		data := block.Data
+		for len(data) > DEFINE_WIDTH {
+			b.WriteString(data[:DEFINE_WIDTH] + "\n")
+			data = data[DEFINE_WIDTH:]
+		}
+		b.WriteString(data + ";\n")
+	}
+	return b.String(), nil
+}
+
+/* Formats an operand, with the space before it. Named tiles keep their
+names, unless exporting. */
+func operandText(operand Operand, export bool) string {
+	tile := strconv.Itoa(operand.Tile)
+	if operand.Name != "" && !export {
+		tile = operand.Name
+	}
+	switch operand.Type {
+	case OPERAND_LABEL:
+		return " " + operand.Name
+	case OPERAND_TILE:
+		return " " + tile
+	case OPERAND_INDIRECT:
+		return " [" + tile + "]"
+	}
+	return ""
+}
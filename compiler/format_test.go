@@ -0,0 +1,84 @@
+package hrm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/* Formats a source, failing the test if it does not compile. */
+func formatTest(t *testing.T, source string) string {
+	t.Helper()
+	formatted, diagnostics := Format(source)
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	return formatted
+}
+
+/* Formatting a solution again changes nothing, and keeps its DEFINE
+blocks and the names given to them by the comments above. */
+func TestFormatLevels(t *testing.T) {
+	paths, err := filepath.Glob("../levels/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted := formatTest(t, string(source))
+		if again := formatTest(t, formatted); again != formatted {
+			t.Errorf("%s: formatting twice gave\n%s\nrather than\n%s", path, again, formatted)
+		}
+		before := compileTest(t, string(source)).Definitions
+		after := compileTest(t, formatted).Definitions
+		if len(before) != len(after) {
+			t.Fatalf("%s: expected %d DEFINE blocks, got %d.", path, len(before), len(after))
+		}
+		for i, d := range after {
+			d.Line = before[i].Line
+			if !reflect.DeepEqual(d, before[i]) {
+				t.Errorf("%s: expected the DEFINE block %+v, got %+v.", path, before[i], d)
+			}
+		}
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	source, err := ioutil.ReadFile("../levels/22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := formatTest(t, string(source))
+	for _, block := range []string{
+		"-- a --\nDEFINE LABEL 0\n",
+		"-- b --\nDEFINE LABEL 1\n",
+		"-- counter --\nDEFINE LABEL 5\n",
+		"-- null --\nDEFINE LABEL 9\n",
+	} {
+		if !strings.Contains(formatted, block) {
+			t.Errorf("Expected the output to keep\n%s", block)
+		}
+	}
+	formatted = formatTest(t, "-- read one --\nINBOX\n    OUTBOX -- and send it\n")
+	expected := PROGRAM_HEADER + "\n\n-- read one --\n    INBOX\n    OUTBOX -- and send it\n"
+	if formatted != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, formatted)
+	}
+}
+
+func TestExport(t *testing.T) {
+	source := "TILE sum = 3\n-- @tile 4 count\n    INBOX\n    COPYTO sum\n    COPYFROM [count]\n    ADD sum\n    OUTBOX\n"
+	exported, diagnostics := Export(source)
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	expected := PROGRAM_HEADER + "\n\n    INBOX\n    COPYTO 3\n    COPYFROM [4]\n    ADD 3\n    OUTBOX\n"
+	if exported != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, exported)
+	}
+}
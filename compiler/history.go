@@ -0,0 +1,126 @@
+package hrm
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+/* A record holds what is needed to undo one instruction: the ip, hand,
+inbox cursor and steps before it ran, and the tile it wrote with the
+value it replaced. Tile is -1 if no tile was written. Outbox is the length
+of the outbox before the instruction, which grows by at most one. */
+type record struct {
+	ip int
+	hand Value
+	inbox int
+	steps int
+	outbox int
+	tile int
+	old Value
+}
+
+/* The most instructions kept in the history. Once it is full, the oldest
+half is forgotten, so that a program stuck in a loop does not use up all
+memory. */
+const HISTORY_LIMIT = 1 << 20
+
+/* Records the state before the instruction about to run, which writes
+the given tile. While the history is not recorded, it is forgotten. */
+func (d *Debugger) record(tile int) {
+	if !d.recording {
+		d.history = d.history[:0]
+		d.forgotten = true
+		return
+	}
+	if len(d.history) >= HISTORY_LIMIT {
+		n := copy(d.history, d.history[len(d.history) / 2:])
+		d.history = d.history[:n]
+		d.forgotten = true
+	}
+	r := record{
+		ip: d.vm.ip,
+		hand: d.vm.hand,
+		inbox: len(d.inbox) - len(d.vm.inbox),
+		steps: d.vm.steps,
+		outbox: len(d.outbox),
+		tile: tile,
+	}
+	if tile >= 0 {
+		r.old = d.vm.registers[tile]
+	}
+	d.history = append(d.history, r)
+}
+
+/* Undoes the last instruction run, returning its record. */
+func (d *Debugger) undo() record {
+	r := d.history[len(d.history) - 1]
+	d.history = d.history[:len(d.history) - 1]
+	d.vm.ip = r.ip
+	d.vm.hand = r.hand
+	d.vm.inbox = d.inbox[r.inbox:]
+	d.vm.steps = r.steps
+	d.vm.err = nil
+	d.outbox = d.outbox[:r.outbox]
+	if r.tile >= 0 {
+		d.vm.registers[r.tile] = r.old
+	}
+	d.state = INTERPRET_OK
+	d.halted = false
+	return r
+}
+
+/* Runs a single instruction backwards. */
+func (d *Debugger) ReverseStep() Stop {
+	return d.reverse(func(int) bool { return true })
+}
+
+/* Runs backwards until a breakpoint is reached, a watched tile is
+restored to its value before it was written, or a condition becomes true.
+The program stops before the instruction responsible. */
+func (d *Debugger) ReverseContinue() Stop {
+	return d.reverse(func(int) bool { return false })
+}
+
+/* Runs instructions backwards until one of them stops the program, or
+until reports true for the index of the instruction about to run. */
+func (d *Debugger) reverse(until func(int) bool) Stop {
+	for {
+		if len(d.history) == 0 && d.forgotten {
+			return Stop{STOP_START, "Reached the start of the recorded history."}
+		}
+		if len(d.history) == 0 {
+			return Stop{STOP_START, "Reached the start of the program."}
+		}
+		after := d.holds()
+		var written Value
+		if last := d.history[len(d.history) - 1]; last.tile >= 0 {
+			written = d.vm.registers[last.tile]
+		}
+		r := d.undo()
+		i := d.current()
+		in := d.instructions[i]
+		if in.op == OP_HALT {
+			// The final HALT is not part of the source, so keep going
+			continue
+		}
+		if r.tile >= 0 && d.watches[r.tile] {
+			return Stop{STOP_WATCH, fmt.Sprintf("Tile %d is written here by %s: %s -> %s.",
+				r.tile, in, valueText(r.old), valueText(written))}
+		}
+		before := d.holds()
+		for j, c := range d.conditions {
+			if after[j] && !before[j] {
+				return Stop{STOP_CONDITION, fmt.Sprintf("Condition %d becomes true after this instruction: %s.", j + 1, c.text)}
+			}
+		}
+		if d.breakpoints[d.vm.ip] {
+			return Stop{STOP_BREAKPOINT, fmt.Sprintf("Breakpoint at line %d.", in.line)}
+		}
+		if until(i) {
+			return Stop{STOP_STEP, ""}
+		}
+		if atomic.CompareAndSwapInt32(&d.paused, 1, 0) {
+			return Stop{STOP_PAUSE, "Paused."}
+		}
+	}
+}
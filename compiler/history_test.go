@@ -0,0 +1,94 @@
+package hrm
+
+import (
+	"reflect"
+	"testing"
+)
+
+/* The state of a debugged program, which running backwards must restore. */
+type debugState struct {
+	ip int
+	hand Value
+	floor Floor
+	inbox []Value
+	outbox []Value
+	steps int
+}
+
+/* Copies the state of a debugged program. */
+func snapshot(d *Debugger) debugState {
+	return debugState{
+		ip: d.current(),
+		hand: d.Hand(),
+		floor: append(Floor{}, d.Floor()...),
+		inbox: append([]Value{}, d.Inbox()...),
+		outbox: append([]Value{}, d.Outbox()...),
+		steps: d.Steps(),
+	}
+}
+
+func TestReverseRestoresState(t *testing.T) {
+	d := newLevelDebugger(t, nil)
+	const N = 20
+	states := make([]debugState, 0, N)
+	for i := 0; i < N; i += 1 {
+		states = append(states, snapshot(d))
+		if stop := d.Step(); stop.Reason != STOP_STEP {
+			t.Fatalf("Step %d: expected a step, got %+v.", i + 1, stop)
+		}
+	}
+	if len(d.Outbox()) == 0 {
+		t.Fatal("Expected the steps to reach an OUTBOX.")
+	}
+	for i := N - 1; i >= 0; i -= 1 {
+		if stop := d.ReverseStep(); stop.Reason != STOP_STEP {
+			t.Fatalf("Reverse step %d: expected a step, got %+v.", N - i, stop)
+		}
+		if state := snapshot(d); !reflect.DeepEqual(state, states[i]) {
+			t.Fatalf("After %d reverse steps, expected %+v, got %+v.", N - i, states[i], state)
+		}
+	}
+	if stop := d.ReverseStep(); stop.Reason != STOP_START {
+		t.Errorf("Expected to reach the start, got %+v.", stop)
+	}
+}
+
+/* Swaps pairs like level 4, but overwrites the first of each pair with
+the second, so the second OUTBOX of each pair is wrong. */
+const OVERWRITTEN_SWAP = `loop:
+    INBOX
+    COPYTO 0
+    INBOX
+    COPYTO 0
+    OUTBOX
+    COPYFROM 0
+    OUTBOX
+    JUMP loop
+`
+
+/* Stops at a wrong OUTBOX and runs back to the write which lost the value
+it should have sent. */
+func TestReverseToCorruptingWrite(t *testing.T) {
+	d, diagnostics := NewDebugger(OVERWRITTEN_SWAP, Inbox{IntVal(1), IntVal(2)}, make(Floor, 1), []Value{IntVal(2), IntVal(1)})
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	if _, err := d.Break("8"); err != nil {
+		t.Fatal(err)
+	}
+	expectStop(t, d, d.Continue(), STOP_BREAKPOINT, 6, 6)
+	if d.Hand() != IntVal(2) {
+		t.Fatalf("Expected to be about to send 2, got %v.", d.Hand())
+	}
+	if err := d.Watch(0); err != nil {
+		t.Fatal(err)
+	}
+	stop := d.ReverseContinue()
+	expectStop(t, d, stop, STOP_WATCH, 3, 3)
+	if stop.Message != "Tile 0 is written here by COPYTO 0: 1 -> 2." {
+		t.Errorf("Unexpected message %q.", stop.Message)
+	}
+	if d.Line() != 5 || d.Floor()[0] != IntVal(1) || len(d.Outbox()) != 0 {
+		t.Errorf("Expected to be before the COPYTO on line 5 with tile 0 holding 1, got line %d, %v.", d.Line(), d.Floor())
+	}
+}
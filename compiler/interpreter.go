@@ -2,39 +2,54 @@ package hrm
 
 import (
 	"fmt"
+	"io"
 )
 
 /* A virtual machine stores a chunk of data and executes it. For HRM,
-a register-based VM will be used with 12 registers. Inbox is a read-only
-channel, outbox is a write-only channel. */
+a register-based VM is used, with a register for each tile of the floor.
+Each instruction holds its tile inline, so no operand stack is needed.
+Inbox is a read-only channel, outbox is a write-only channel. */
 type VM struct {
 	chunk *Chunk
-	debug bool
+	current int
+	debug io.Writer
+	err *RuntimeError
 	hand Value
 	inbox []Value
 	ip int
 	outbox *[]Value
 	registers []Value
-	stack []Value
-	stackTop int
 	steps int
+	stepMode StepMode
 }
 
-/* Handler for runtime errors. */
-func (vm *VM) raiseError(format string, err ...interface{}) {
-	if len(err) > 0 {
-		fmt.Printf(format, err...)
+/* Handler for runtime errors. The error is recorded against the
+instruction being executed, and tile is -1 if no tile is involved. */
+func (vm *VM) raiseError(kind ErrorKind, tile int, format string, args ...interface{}) {
+	in := vm.chunk.code[vm.current]
+	vm.err = &RuntimeError{
+		Line: in.line,
+		Column: in.column,
+		Instruction: instructionName(in.op),
+		Tile: tile,
+		Kind: kind,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+/* Raises an error returned by an operation on values. */
+func (vm *VM) raiseValueError(err error, tile int) {
+	if e, ok := err.(*RuntimeError); ok {
+		vm.raiseError(e.Kind, tile, "%s", e.Message)
 		return
 	}
-	instruction := vm.ip - 1
-	line := vm.chunk.lines[instruction]
-	fmt.Printf("[Ln %d] Runtime Error: %s", line, format)
-	vm.stackTop = 0
+	vm.raiseError(ERR_NOT_A_NUMBER, tile, "%s", err.Error())
 }
 
-/* Initializes the virtual machine. */
+/* Initializes the virtual machine. Instructions are traced to debug
+as they execute, unless it is nil. */
 func (vm *VM) Init(
-		debug bool,
+		debug io.Writer,
 		inbox []Value,
 		outbox *[]Value,
 		registers []Value,
@@ -45,6 +60,22 @@ func (vm *VM) Init(
 	vm.registers = registers
 }
 
+/* An enum representing how executed instructions are charged as steps.
+The game charges every instruction that runs, including a JUMPZ or JUMPN
+whose branch is not taken. The INBOX which finds the inbox empty ends the
+program and is not charged. STEPS_TAKEN_JUMPS only charges conditional
+jumps when their branch is taken. */
+type StepMode int
+const (
+	STEPS_GAME StepMode = iota
+	STEPS_TAKEN_JUMPS
+)
+
+/* Sets how the VM counts steps. */
+func (vm *VM) SetStepMode(mode StepMode) {
+	vm.stepMode = mode
+}
+
 /* An enum representing the state of executing the VM's instructions. */
 type INTERPRET_STATE int
 const (
@@ -58,44 +89,20 @@ const (
 		"Try writing something to that tile first."
 	EMPTY_HAND_ERROR = "Empty value! You can't %s with empty hands!"
 	NAN_ERROR = "Value is not a number, cannot %s!"
+	NO_TILE_ERROR = "There are only %d slots available on this floor!"
+	BAD_ADDRESS_ERROR = "Bad tile address! Tile with address %d does not exist! " +
+		"Where do you think you're going?"
+	BAD_POINTER_ERROR = "Bad tile address! You can't use %v as a tile address! " +
+		"Only numbers can be used as addresses."
 )
 
-/* Reads the next byte in the chunk. */
-func (vm *VM) readByte() byte {
-	val := vm.chunk.code[vm.ip]
-	vm.ip += 1
-	return val
-}
-
-/* Retrieves the next constant value from the chunk's constant pool. */
-func (vm *VM) readConstant() Value {
-	index := vm.readByte()
-	return vm.chunk.constants[index]
-}
-
-/* Reads a register by its index. */
-func (vm *VM) readRegister() int {
-	value := vm.pop()
-	return value.Int
-}
-
-/* Pushes a value onto the stack. */
-func (vm *VM) push(value Value) {
-	vm.stack = append(vm.stack, value)
-	vm.stackTop += 1
-}
-
-/* Pops a value from the stack. */
-func (vm *VM) pop() Value {
-	vm.stackTop -= 1
-	top := vm.stack[vm.stackTop]
-	vm.stack = vm.stack[:vm.stackTop]
-	return top
-}
-
-/* Peeks n values from the top of the stack. */
-func (vm *VM) peek(n int) Value {
-	return vm.stack[vm.stackTop - 1 - n]
+/* Returns the register an instruction uses. An indirect address is
+resolved through the tile holding it, which may fail. */
+func (vm *VM) readRegister(in *instruction) (int, bool) {
+	if in.indirect {
+		return vm.derefRegister(in.tile)
+	}
+	return in.tile, true
 }
 
 /* Picks up an item, discarding anything currently held. */
@@ -109,9 +116,9 @@ func (vm *VM) take(value Value) bool {
 
 /* Picks up an item from the given register, if possible. */
 func (vm *VM) takeRegister(register int, opcode string) bool {
-	ok := vm.take(vm.registers[register])
-	if !ok {
-		vm.raiseError(EMPTY_TILE_ERROR, opcode)
+	value, ok := vm.checkRegister(register, opcode)
+	if ok {
+		vm.take(value)
 	}
 	return ok
 }
@@ -130,8 +137,11 @@ func (vm *VM) drop() (Value, bool) {
 /* Copies an item to the given register, if possible. */
 func (vm *VM) copyRegister(register int, opcode string) bool {
 	value := vm.hand
-	if value.Type == VAL_EMPTY {
-		vm.raiseError(EMPTY_HAND_ERROR, opcode)
+	if register < 0 || register >= len(vm.registers) {
+		vm.raiseError(ERR_NO_TILE, register, NO_TILE_ERROR, len(vm.registers))
+		return false
+	} else if value.Type == VAL_EMPTY {
+		vm.raiseError(ERR_EMPTY_HAND, register, EMPTY_HAND_ERROR, opcode)
 		return false
 	} else {
 		vm.registers[register] = value
@@ -142,154 +152,175 @@ func (vm *VM) copyRegister(register int, opcode string) bool {
 /* Checks the value at a given register and returns it if not empty. */
 func (vm *VM) checkRegister(register int, opcode string) (Value, bool) {
 	if register < 0 || register >= len(vm.registers) {
-		vm.raiseError("There are only %d slots available on this floor!", len(vm.registers))
+		vm.raiseError(ERR_NO_TILE, register, NO_TILE_ERROR, len(vm.registers))
 		return Value{}, false
 	}
 	value := vm.registers[register]
 	if value.Type == VAL_EMPTY {
-		vm.raiseError(EMPTY_TILE_ERROR, opcode)
+		vm.raiseError(ERR_EMPTY_TILE, register, EMPTY_TILE_ERROR, opcode)
 		return Value{}, false
 	}
 	return value, true
 }
 
+/* Combines the value held with a value from the floor, keeping the
+result in hand. */
+func (vm *VM) arithmetic(op func(Value, Value) (Value, error), register int, value Value, opcode string) bool {
+	if vm.hand.Type == VAL_EMPTY {
+		vm.raiseError(ERR_EMPTY_HAND, -1, EMPTY_HAND_ERROR, opcode)
+		return false
+	}
+	result, err := op(vm.hand, value)
+	if err != nil {
+		vm.raiseValueError(err, register)
+		return false
+	}
+	vm.hand = result
+	return true
+}
+
+/* Adds n to the value at a given register. The result is written back
+to the floor, and also back into the hand. */
+func (vm *VM) bumpRegister(register int, n int, opcode string) bool {
+	value, ok := vm.checkRegister(register, opcode)
+	if !ok {
+		return false
+	}
+	result, err := value.Bump(n, opcode)
+	if err != nil {
+		vm.raiseValueError(err, register)
+		return false
+	}
+	vm.take(result)
+	return vm.copyRegister(register, opcode)
+}
+
+/* Resolves an indirect address by reading the tile at the given register.
+The tile must contain an integer that is itself a valid register. */
+func (vm *VM) derefRegister(register int) (int, bool) {
+	value, ok := vm.checkRegister(register, "dereference")
+	if !ok {
+		return 0, false
+	}
+	if value.Type != VAL_INT {
+		vm.raiseError(ERR_BAD_POINTER, register, BAD_POINTER_ERROR, value)
+		return 0, false
+	}
+	if value.Int < 0 || value.Int >= len(vm.registers) {
+		vm.raiseError(ERR_BAD_ADDRESS, register, BAD_ADDRESS_ERROR, value.Int)
+		return 0, false
+	}
+	return value.Int, true
+}
+
 /* Executes the VM's instructions, 1 code at a time.
 This is the most performance-critical part of the machine. */
 func (vm *VM) run() INTERPRET_STATE {
 	for {
-		instruction := vm.readByte();
-		if vm.debug {
-			DisassembleInstruction(vm.chunk, vm.ip - 1)
-			fmt.Printf("Regs    : %v\n", vm.registers)
-			fmt.Printf("Stack   : %v\n", vm.stack)
-			fmt.Printf("Hand	: %v\n\n", vm.hand)
+		if state, halted := vm.step(); halted {
+			return state
 		}
-		switch instruction {
-		case OP_HALT:
-			return INTERPRET_OK
-		case OP_POP:
-			vm.pop();
-		case OP_CONSTANT:
-			constant := vm.readConstant()
-			vm.push(constant)
-		case OP_INBOX:
-			if len(vm.inbox) > 0 {
-				vm.take(vm.inbox[0])
-				vm.inbox = vm.inbox[1:]
-				vm.steps += 1
-			} else {
-				return INTERPRET_OK
-			}
-		case OP_OUTBOX:
-			value, ok := vm.drop()
-			if !ok {
-				vm.raiseError(EMPTY_HAND_ERROR, "OUTBOX")
-				return INTERPRET_RUNTIME_ERROR
-			}
-			*vm.outbox = append(*vm.outbox, value)
-			vm.steps += 1
-		case OP_JUMP:
-			offset := vm.readByte()
-			vm.ip = int(offset)
-			vm.steps += 1
-		case OP_JUMPZ:
-			offset := vm.readByte()
-			value := vm.hand
-			if value.Type == VAL_INT && value.Int == 0 {
-				vm.ip = int(offset)
-				vm.steps += 1
-			}
-		case OP_JUMPN:
-			offset := vm.readByte()
-			value := vm.hand
-			if value.Type == VAL_INT && value.Int < 0 {
-				vm.ip = int(offset)
-				vm.steps += 1
-			}
-		case OP_COPYFROM:
-			register := vm.readRegister()
-			ok := vm.takeRegister(register, "COPYFROM")
-			if !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			vm.steps += 1
-		case OP_COPYTO:
-			register := vm.readRegister()
-			ok := vm.copyRegister(register, "COPYTO")
-			if !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
+	}
+}
+
+/* Executes a single instruction. Returns the state of the VM, and
+whether the program has stopped. */
+func (vm *VM) step() (INTERPRET_STATE, bool) {
+	vm.current = vm.ip
+	in := &vm.chunk.code[vm.ip]
+	vm.ip += 1
+	if vm.debug != nil {
+		DisassembleInstruction(vm.debug, vm.chunk, vm.current)
+		fmt.Fprintf(vm.debug, "Regs    : %v\n", vm.registers)
+		fmt.Fprintf(vm.debug, "Hand	: %v\n\n", vm.hand)
+	}
+	switch in.op {
+	case OP_HALT:
+		return INTERPRET_OK, true
+	case OP_INBOX:
+		if len(vm.inbox) > 0 {
+			vm.take(vm.inbox[0])
+			vm.inbox = vm.inbox[1:]
 			vm.steps += 1
-		case OP_ADD:
-			register := vm.readRegister()
-			value, ok := vm.checkRegister(register, "ADD")
-			if !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if value.Type != VAL_INT {
-				vm.raiseError(NAN_ERROR, "ADD")
-				return INTERPRET_RUNTIME_ERROR
-			}
-			vm.hand.Int += value.Int
+		} else {
+			return INTERPRET_OK, true
+		}
+	case OP_OUTBOX:
+		value, ok := vm.drop()
+		if !ok {
+			vm.raiseError(ERR_EMPTY_HAND, -1, EMPTY_HAND_ERROR, "OUTBOX")
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		*vm.outbox = append(*vm.outbox, value)
+		vm.steps += 1
+	case OP_JUMP:
+		vm.ip = in.target
+		vm.steps += 1
+	case OP_JUMPZ:
+		value := vm.hand
+		if value.Type == VAL_INT && value.Int == 0 {
+			vm.ip = in.target
 			vm.steps += 1
-		case OP_SUB:
-			register := vm.readRegister()
-			value, ok := vm.checkRegister(register, "SUB")
-			if !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if value.Type != VAL_INT {
-				vm.raiseError(NAN_ERROR, "SUB")
-				return INTERPRET_RUNTIME_ERROR
-			}
-			vm.hand.Int -= value.Int
+		} else if vm.stepMode == STEPS_GAME {
 			vm.steps += 1
-		case OP_BUMPUP:
-			register := vm.readRegister()
-			value, ok := vm.checkRegister(register, "BUMP+")
-			if !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if value.Type != VAL_INT {
-				vm.raiseError(NAN_ERROR, "BUMP+")
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if ok := vm.take(IntVal(value.Int + 1)); !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if ok := vm.copyRegister(register, "BUMP+"); !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
+		}
+	case OP_JUMPN:
+		value := vm.hand
+		if value.Type == VAL_INT && value.Int < 0 {
+			vm.ip = in.target
 			vm.steps += 1
-		case OP_BUMPDN:
-			register := vm.readRegister()
-			value, ok := vm.checkRegister(register, "BUMP-")
-			if !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if value.Type != VAL_INT {
-				vm.raiseError(NAN_ERROR, "BUMP-")
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if ok := vm.take(IntVal(value.Int - 1)); !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
-			if ok := vm.copyRegister(register, "BUMP-"); !ok {
-				return INTERPRET_RUNTIME_ERROR
-			}
+		} else if vm.stepMode == STEPS_GAME {
 			vm.steps += 1
-		case OP_NEGATE:
-			fmt.Printf("OP_NEGATE\n")
-			if vm.peek(0).Type != VAL_INT {
-				vm.raiseError(NAN_ERROR, "NEGATE")
-				return INTERPRET_RUNTIME_ERROR
-			}
-			vm.push(IntVal(-vm.pop().Int))
-		default:
-			fmt.Printf("Unknown opcode %d.", instruction)
-			return INTERPRET_RUNTIME_ERROR
 		}
+	case OP_COPYFROM:
+		register, ok := vm.readRegister(in)
+		if !ok || !vm.takeRegister(register, "COPYFROM") {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		vm.steps += 1
+	case OP_COPYTO:
+		register, ok := vm.readRegister(in)
+		if !ok || !vm.copyRegister(register, "COPYTO") {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		vm.steps += 1
+	case OP_ADD:
+		register, ok := vm.readRegister(in)
+		if !ok {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		value, ok := vm.checkRegister(register, "ADD")
+		if !ok || !vm.arithmetic(Value.Add, register, value, "ADD") {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		vm.steps += 1
+	case OP_SUB:
+		register, ok := vm.readRegister(in)
+		if !ok {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		value, ok := vm.checkRegister(register, "SUB")
+		if !ok || !vm.arithmetic(Value.Sub, register, value, "SUB") {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		vm.steps += 1
+	case OP_BUMPUP:
+		register, ok := vm.readRegister(in)
+		if !ok || !vm.bumpRegister(register, 1, "BUMP+") {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		vm.steps += 1
+	case OP_BUMPDN:
+		register, ok := vm.readRegister(in)
+		if !ok || !vm.bumpRegister(register, -1, "BUMP-") {
+			return INTERPRET_RUNTIME_ERROR, true
+		}
+		vm.steps += 1
+	default:
+		vm.raiseError(ERR_UNKNOWN_OPCODE, -1, "Unknown opcode %d.", in.op)
+		return INTERPRET_RUNTIME_ERROR, true
 	}
+	return INTERPRET_OK, false
 }
 
 type INFO struct {
@@ -300,14 +331,30 @@ type INFO struct {
 func (vm *VM) Interpret(source string) (INTERPRET_STATE, INFO) {
 	var chunk Chunk
 	chunk.Init()
-	size, ok := vm.Compile(source, &chunk)
-	if !ok {
+	size, diagnostics := compile(source, &chunk)
+	if len(diagnostics) > 0 {
 		return INTERPRET_COMPILE_ERROR, INFO{}
 	}
-	vm.chunk = &chunk
-	vm.ip = 0
-	vm.steps = 0
-	result := vm.run()
+	result := vm.Execute(&chunk)
 	info := INFO{vm.steps, size}
 	return result, info
 }
+
+/* Executes an already compiled chunk from its first instruction. The
+chunk is verified first, and not run at all if it is not safe. */
+func (vm *VM) Execute(chunk *Chunk) INTERPRET_STATE {
+	vm.reset(chunk)
+	if err := chunk.verify(len(vm.registers)); err != nil {
+		vm.err = err
+		return INTERPRET_RUNTIME_ERROR
+	}
+	return vm.run()
+}
+
+/* Readies the VM to run a chunk from its first instruction. */
+func (vm *VM) reset(chunk *Chunk) {
+	vm.chunk = chunk
+	vm.ip = 0
+	vm.steps = 0
+	vm.err = nil
+}
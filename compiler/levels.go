@@ -1,13 +1,13 @@
 package hrm
 import (
-	// "fmt"
 	"math"
 )
 
 /* By design, test cases are generated automatically to consider individual edge cases
-for each level. A better approach would be to determine the exact test case input in
-the game; this way, we get the same number of steps during execution time rather than
-testing all possible combinations of expected inputs. */
+for each level. When a random source is given, levels instead generate short inboxes
+from the same value ranges and lengths as the game; this way, the number of steps
+during execution is comparable to the in-game speed challenge rather than the sum over
+all possible combinations of expected inputs. */
 
 /* 
 Level 1: Mail Room
@@ -18,10 +18,16 @@ it into the OUTBOX.
 */
 
 func Level1(d data) {
-	*d.inbox = generateInputs(1, IntegerSlice(1, 3, 1))
-	for _, x := range *d.inbox {
-		*d.expected = append(*d.expected, x)
+	*d.goal = INFO{size: 6, steps: 6}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 3, GAME_ALPHANUMERIC))
+	} else {
+		inbox = generateInputs(1, IntegerSlice(1, 3, 1))
 	}
+	d.addInputs(inbox, 3, func(inbox []Value) []Value {
+		return append([]Value{}, inbox...)
+	})
 }
 
 /*
@@ -32,17 +38,17 @@ You got a new command! You can drag JUMP's arrow to different lines within your
 program.
 */
 func Level2(d data) {
-	for _, c := range "INITIALIZE" {
-		*d.inbox = append(*d.inbox, CharVal(c))
+	*d.goal = INFO{size: 3, steps: 25}
+	var words [][]Value
+	if d.random() {
+		words = append(words, randomInputs(d.rng, 12, GAME_LETTERS))
+	} else {
+		words = append(words, stringValues("INITIALIZE"))
+		words = append(words, stringValues("BOOTSEQUENCE"))
+		words = append(words, stringValues("AUTOEXEC"))
 	}
-	for _, c := range "BOOTSEQUENCE" {
-		*d.inbox = append(*d.inbox, CharVal(c))
-	}
-	for _, c := range "AUTOEXEC" {
-		*d.inbox = append(*d.inbox, CharVal(c))
-	}
-	for _, x := range *d.inbox {
-		*d.expected = append(*d.expected, x)
+	for _, word := range words {
+		d.add(word, append([]Value{}, word...))
 	}
 }
 
@@ -55,11 +61,14 @@ The Facilities Management staff has placed some items over there on the carpet
 for you. If only there were a way to pick them up...
 */
 func Level3(d data) {
+	*d.goal = INFO{size: 6, steps: 6}
+	inbox := make([]Value, 0)
 	for i := 0; i < 4; i += 1 {
-		*d.inbox = append(*d.inbox, IntVal(-99))
+		inbox = append(inbox, IntVal(-99))
 	}
+	expected := make([]Value, 0)
 	for _, c := range "BUG" {
-		*d.expected = append(*d.expected, CharVal(c))
+		expected = append(expected, CharVal(c))
 	}
 	*d.registers = []Value{
 		CharVal('U'),
@@ -69,6 +78,7 @@ func Level3(d data) {
 		CharVal('B'),
 		CharVal('E'),
 	}
+	d.add(inbox, expected)
 }
 
 /*
@@ -80,12 +90,21 @@ You got a new command! Feel free to COPYTO wherever you like on the carpet. It
 will be cleaned later.
 */
 func Level4(d data) {
-	inbox := generateInputs(2, ALPHANUMERIC)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		*d.expected = append(*d.expected, inbox[i + 1], inbox[i])
+	*d.goal = INFO{size: 7, steps: 21}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 6, GAME_ALPHANUMERIC))
+	} else {
+		inbox = generateInputs(2, ALPHANUMERIC)
 	}
-	*d.inbox = inbox
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 3, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			expected = append(expected, inbox[i + 1], inbox[i])
+		}
+		return expected
+	})
 }
 
 /* Level 5: Coffee Time (Cutscene) */
@@ -99,13 +118,22 @@ You got a new command! It ADDs the contents of a tile on the floor to whatever
 value you're currently holding.
 */
 func Level6(d data) {
-	inbox := generateInputs(2, ALL_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		sum := inbox[i].Int + inbox[i + 1].Int
-		*d.expected = append(*d.expected, IntVal(sum))
+	*d.goal = INFO{size: 6, steps: 24}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(2, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			sum := inbox[i].Int + inbox[i + 1].Int
+			expected = append(expected, IntVal(sum))
+		}
+		return expected
+	})
 }
 
 /* 
@@ -115,14 +143,23 @@ Send all things that ARE NOT ZERO to the OUTBOX.
 You got a new command! It jumps ONLY if the value you are holding is ZERO. Otherwise
 it continues to the next line. */
 func Level7(d data) {
-	inbox := generateInputs(1, ALPHANUMERIC)
-	for i := 0; i < len(inbox); i += 1 {
-		if inbox[i].Type != VAL_INT || inbox[i].Int != 0 {
-			*d.expected = append(*d.expected, inbox[i])
-		}
+	*d.goal = INFO{size: 4, steps: 23}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_ALPHANUMERIC, GAME_ZEROS))
+	} else {
+		inbox = generateInputs(1, ALPHANUMERIC)
 	}
-	*d.inbox = inbox
 	allocateRegisters(9, d.registers)
+	d.addInputs(inbox, 8, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			if inbox[i].Type != VAL_INT || inbox[i].Int != 0 {
+				expected = append(expected, inbox[i])
+			}
+		}
+		return expected
+	})
 }
 
 /* 
@@ -133,27 +170,45 @@ Self-improvement tip: Where are we going with this? Please leave the high level
 decisions to management.
 */
 func Level8(d data) {
-	inbox := generateInputs(1, ALL_INTEGERS)
-	for i := 0; i < len(inbox); i += 1 {
-		num := inbox[i].Int * 3
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 6, steps: 24}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(1, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			num := inbox[i].Int * 3
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /*
 Level 9: Zero Preservation Initiative
 Send only ZEROs to the OUTBOX. */
 func Level9(d data) {
-	inbox := generateInputs(1, ALPHANUMERIC)
-	for i := 0; i < len(inbox); i += 1 {
-		if inbox[i].Type == VAL_INT && inbox[i].Int == 0 {
-			*d.expected = append(*d.expected, inbox[i])
-		}
+	*d.goal = INFO{size: 5, steps: 25}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_ALPHANUMERIC, GAME_ZEROS))
+	} else {
+		inbox = generateInputs(1, ALPHANUMERIC)
 	}
-	*d.inbox = inbox
 	allocateRegisters(9, d.registers)
+	d.addInputs(inbox, 8, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			if inbox[i].Type == VAL_INT && inbox[i].Int == 0 {
+				expected = append(expected, inbox[i])
+			}
+		}
+		return expected
+	})
 }
 
 /*
@@ -163,13 +218,22 @@ For each thing in the INBOX, multiply it by 8, and put the result in the OUTBOX.
 Using a bunch of ADD commands is easy, but WASTEFUL! Can you do it using only
 3 ADD commands? Management is watching. */
 func Level10(d data) {
-	inbox := generateInputs(1, ALL_INTEGERS)
-	for i := 0; i < len(inbox); i += 1 {
-		num := inbox[i].Int * 8
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 9, steps: 36}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(1, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(5, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			num := inbox[i].Int * 8
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /*
@@ -181,15 +245,23 @@ and put the result in the OUTBOX. AND THEN, subtract the 2nd from the
 You got a new command! SUBtracts the contents of a tile on the floor
 FROM whatever value you're currently holding. */
 func Level11(d data) {
-	/* todo not working, works in game */
-	inbox := generateInputs(2, ALL_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		diff := inbox[i].Int - inbox[i + 1].Int
-		rdiff := inbox[i + 1].Int - inbox[i].Int
-		*d.expected = append(*d.expected, IntVal(rdiff), IntVal(diff))
-	}
-	*d.inbox = inbox
+	*d.goal = INFO{size: 10, steps: 40}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(2, ALL_INTEGERS)
+	}
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			diff := inbox[i].Int - inbox[i + 1].Int
+			rdiff := inbox[i + 1].Int - inbox[i].Int
+			expected = append(expected, IntVal(rdiff), IntVal(diff))
+		}
+		return expected
+	})
 }
 
 /*
@@ -197,13 +269,22 @@ Level 12: Tetracontiplier
 For each thing in the INBOX, multiply it by 40,
 and put the result in the OUTBOX. */
 func Level12(d data) {
-	inbox := generateInputs(1, ALL_INTEGERS)
-	for i := 0; i < len(inbox); i += 1 {
-		num := inbox[i].Int * 40
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 14, steps: 56}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(1, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(5, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			num := inbox[i].Int * 40
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /*
@@ -213,16 +294,25 @@ Discard non-equal pairs. Repeat!
 
 You got... COMMENTS! You can use them, if you like, to mark sections of your program. */
 func Level13(d data) {
-	inbox := generateInputs(2, ALL_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		a := inbox[i]
-		b := inbox[i + 1]
-		if a.Int == b.Int {
-			*d.expected = append(*d.expected, IntVal(a.Int))
-		}
+	*d.goal = INFO{size: 9, steps: 27}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(2, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			a := inbox[i]
+			b := inbox[i + 1]
+			if a.Int == b.Int {
+				expected = append(expected, IntVal(a.Int))
+			}
+		}
+		return expected
+	})
 }
 
 /*
@@ -233,13 +323,22 @@ If they are equal, just pick either one. Repeat!
 You got a new command! Jumps only if the thing you're holding is negative.
 (Less than zero). Otherwise continues to the next line. */
 func Level14(d data) {
-	inbox := generateInputs(2, ALL_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		num := int(math.Max(float64(inbox[i].Int), float64(inbox[i + 1].Int)))
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 10, steps: 34}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(2, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			num := int(math.Max(float64(inbox[i].Int), float64(inbox[i + 1].Int)))
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /* Level 15: Employee Morale Insertion (Cutscene) */
@@ -249,13 +348,22 @@ Level 16: Absolute Positivity
 Send each thing from the INBOX to the OUTBOX. BUT, if a number is negative,
 first remove its negative sign. */
 func Level16(d data) {
-	inbox := generateInputs(1, ALL_INTEGERS)
-	for i := 0; i < len(inbox); i += 1 {
-		num := int(math.Abs(float64(inbox[i].Int)))
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 8, steps: 36}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(1, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(3, d.registers)
+	d.addInputs(inbox, 8, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			num := int(math.Abs(float64(inbox[i].Int)))
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /*
@@ -266,19 +374,13 @@ Send a 0 to the OUTBOX if they have the same sign. (Both positive or both negati
 
 Send a 1 to the OUTBOX if their signs are different. Repeat until the INBOX is empty. */
 func Level17(d data) {
-	inbox := generateInputs(2, ALL_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		a := inbox[i].Int
-		b := inbox[i + 1].Int
-		var num int
-		if math.Signbit(float64(a)) == math.Signbit(float64(b)) {
-			num = 0
-		} else {
-			num = 1
-		}
-		*d.expected = append(*d.expected, IntVal(num))
-	}
-	*d.inbox = inbox
+	*d.goal = INFO{size: 12, steps: 28}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, nonZero(GAME_INTEGERS)))
+	} else {
+		inbox = generateInputs(2, ALL_INTEGERS)
+	}
 	*d.registers = []Value{
 		EmptyVal(),
 		EmptyVal(),
@@ -287,6 +389,21 @@ func Level17(d data) {
 		IntVal(0),
 		IntVal(1),
 	}
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			a := inbox[i].Int
+			b := inbox[i + 1].Int
+			var num int
+			if math.Signbit(float64(a)) == math.Signbit(float64(b)) {
+				num = 0
+			} else {
+				num = 1
+			}
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /* Level 18: Sabbatical Beach Paradise (Cutscene) */
@@ -300,21 +417,30 @@ You got new commands! They add ONE or subtract ONE from an item on the floor.
 The result is given back to you, and for your convenience, also written right
 back on the floor. BUMP! */
 func Level19(d data) {
-	inbox := generateInputs(1, ALL_INTEGERS)
-	for i := 0; i < len(inbox); i += 1 {
-		num := inbox[i].Int
-		for num != 0 {
-			*d.expected = append(*d.expected, IntVal(num))
-			if num < 0 {
-				num += 1
-			} else {
-				num -= 1
-			}
-		}
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 10, steps: 82}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(1, ALL_INTEGERS)
 	}
-	*d.inbox = inbox
 	allocateRegisters(10, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			num := inbox[i].Int
+			for num != 0 {
+				expected = append(expected, IntVal(num))
+				if num < 0 {
+					num += 1
+				} else {
+					num -= 1
+				}
+			}
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /*
@@ -325,13 +451,13 @@ Don't worry about negative numbers for now.
 You got... LABELS! They can help you remember the purpose of each tile on the
 floor. Just tap any tile on the floor to edit. */
 func Level20(d data) {
-	inbox := generateInputs(2, POSITIVE_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		a := inbox[i].Int
-		b := inbox[i + 1].Int
-		*d.expected = append(*d.expected, IntVal(a * b))
+	*d.goal = INFO{size: 15, steps: 109}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 8, GAME_DIGITS))
+	} else {
+		inbox = generateInputs(2, POSITIVE_INTEGERS)
 	}
-	*d.inbox = inbox
 	*d.registers = []Value{
 		EmptyVal(),
 		EmptyVal(),
@@ -344,6 +470,15 @@ func Level20(d data) {
 		EmptyVal(),
 		IntVal(0),
 	}
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			a := inbox[i].Int
+			b := inbox[i + 1].Int
+			expected = append(expected, IntVal(a * b))
+		}
+		return expected
+	})
 }
 
 /*
@@ -353,17 +488,13 @@ The INBOX is filled with ZERO terminated strings! What's that? Ask me. Your Boss
 Add together all the numbers in each string. When you reach the end of a string
 (marked by a ZERO), put your sum in the OUTBOX. Reset and repeat for each string. */
 func Level21(d data) {
-	inbox := generateInputs(1, ALL_INTEGERS, []Value{IntVal(0)}, POSITIVE_INTEGERS, []Value{IntVal(0)})
-	sum := 0
-	for i := 0; i < len(inbox); i += 1 {
-		if inbox[i].Int != 0 {
-			sum += inbox[i].Int
-		} else {
-			*d.expected = append(*d.expected, IntVal(sum))
-			sum = 0
-		}
+	*d.goal = INFO{size: 10, steps: 72}
+	var strings inputs
+	if d.random() {
+		strings = each(randomStrings(d.rng, 4, 0, 4, nonZero(GAME_INTEGERS))...)
+	} else {
+		strings = each(splitStrings(zeroTerminated(ALL_INTEGERS, POSITIVE_INTEGERS))...)
 	}
-	*d.inbox = inbox
 	*d.registers = []Value{
 		EmptyVal(),
 		EmptyVal(),
@@ -372,6 +503,13 @@ func Level21(d data) {
 		EmptyVal(),
 		IntVal(0),
 	}
+	d.addStrings(strings, 4, func(s []Value) []Value {
+		sum := 0
+		for _, x := range s {
+			sum += x.Int
+		}
+		return []Value{IntVal(sum)}
+	})
 }
 
 /*
@@ -383,17 +521,13 @@ search box.
 
 1 1 2 3 5 8 13 21 34 55 89... */
 func Level22(d data) {
-	inbox := generateInputs(1, POSITIVE_INTEGERS)
-	for i := 0; i < len(inbox); i += 1 {
-		n := inbox[i].Int
-		for a, b := 0, 1; b <= n; {
-			*d.expected = append(*d.expected, IntVal(b))
-			sum := a + b
-			a = b
-			b = sum
-		}
+	*d.goal = INFO{size: 19, steps: 156}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 3, IntegerSlice(1, 30, 1)))
+	} else {
+		inbox = generateInputs(1, POSITIVE_INTEGERS)
 	}
-	*d.inbox = inbox
 	*d.registers = []Value{
 		EmptyVal(),
 		EmptyVal(),
@@ -406,17 +540,50 @@ func Level22(d data) {
 		EmptyVal(),
 		IntVal(0),
 	}
+	d.addInputs(inbox, 3, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			n := inbox[i].Int
+			for a, b := 0, 1; b <= n; {
+				expected = append(expected, IntVal(b))
+				sum := a + b
+				a = b
+				b = sum
+			}
+		}
+		return expected
+	})
 }
 
 /*
 Level 23: The Littlest Number
-For each two things in the INBOX, how many times does the second fully fit into
-the first? Don't worry about negative numbers, divide by zero, or remainders.
+For each zero terminated string in the INBOX, send to the OUTBOX only the SMALLEST
+number you've seen in that string. You will never be given an empty string. Reset
+and repeat for each string.
 
-Self improvement tip: This might be a good time to practice copying and pasting
-from a previous assignment! */
+What's a "zero terminated string"? Go ask your boss on the previous floor! */
 func Level23(d data) {
-	
+	*d.goal = INFO{size: 13, steps: 75}
+	var strings inputs
+	if d.random() {
+		strings = each(randomStrings(d.rng, 3, 1, 5, nonZero(GAME_INTEGERS))...)
+	} else {
+		strings = chain(
+			product(2, nonZero(ALL_INTEGERS)),
+			each([]Value{IntVal(7)}, []Value{IntVal(-7)}),
+			each(IntegerSlice(9, 1, -1), IntegerSlice(-9, -1, 1)),
+		)
+	}
+	allocateRegisters(10, d.registers)
+	d.addStrings(strings, 3, func(s []Value) []Value {
+		min := s[0].Int
+		for _, x := range s {
+			if x.Int < min {
+				min = x.Int
+			}
+		}
+		return []Value{IntVal(min)}
+	})
 }
 
 /*
@@ -425,122 +592,488 @@ For each two things in the INBOX, OUTBOX the remainder that would result if you
 divided the first by the second. Don't worry, you don't actually have to divide.
 And don't worry about negative numbers for now. */
 func Level24(d data) {
-	inbox := generateInputs(1, POSITIVE_INTEGERS)
-	for i := 0; i + 1 < len(inbox); i += 2 {
-		num := inbox[i].Int % inbox[i + 1].Int
-		*d.expected = append(*d.expected, IntVal(num))
+	*d.goal = INFO{size: 10, steps: 57}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomPairs(d.rng, 4, IntegerSlice(0, 19, 1), nonZero(GAME_DIGITS)))
+	} else {
+		inbox = chunks(POSITIVE_INTEGERS, 2)
 	}
-	*d.inbox = inbox
 	allocateRegisters(10, d.registers)
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			num := inbox[i].Int % inbox[i + 1].Int
+			expected = append(expected, IntVal(num))
+		}
+		return expected
+	})
 }
 
 /*
 Level 25: Cumulative Countdown
-... */
+For each thing in the INBOX, OUTBOX the sum of itself plus all numbers down to
+zero. For example, if INBOX is 3, OUTBOX should be 6, because 3+2+1 = 6. */
 func Level25(d data) {
-	
+	*d.goal = INFO{size: 12, steps: 82}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, GAME_DIGITS))
+	} else {
+		inbox = generateInputs(1, POSITIVE_INTEGERS)
+	}
+	*d.registers = []Value{
+		EmptyVal(),
+		EmptyVal(),
+		EmptyVal(),
+		EmptyVal(),
+		EmptyVal(),
+		IntVal(0),
+	}
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			n := inbox[i].Int
+			expected = append(expected, IntVal(n * (n + 1) / 2))
+		}
+		return expected
+	})
 }
 
 /*
 Level 26: Small Divide
-... */
+For each two things in the INBOX, how many times does the second fully fit into
+the first? Don't worry about negative numbers, divide by zero, or remainders.
+
+Self improvement tip: This might be a good time to practice copying and pasting
+from a previous assignment! */
 func Level26(d data) {
-	
+	*d.goal = INFO{size: 15, steps: 76}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomPairs(d.rng, 4, IntegerSlice(0, 19, 1), nonZero(GAME_DIGITS)))
+	} else {
+		inbox = allPairs(POSITIVE_INTEGERS, nonZero(POSITIVE_INTEGERS))
+	}
+	allocateRegisters(9, d.registers)
+	*d.registers = append(*d.registers, IntVal(0))
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 1 < len(inbox); i += 2 {
+			expected = append(expected, IntVal(inbox[i].Int / inbox[i + 1].Int))
+		}
+		return expected
+	})
 }
 
 /* Level 27: Midnight Petroleum (Cutscene) */
 
 /*
 Level 28: Three Sort
-... */
+For each THREE THINGS in the INBOX, send them to the OUTBOX in order from
+smallest to largest. */
 func Level28(d data) {
-	
+	*d.goal = INFO{size: 34, steps: 78}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 12, GAME_INTEGERS))
+	} else {
+		inbox = generateInputs(3, IntegerSlice(-5, 5, 1))
+	}
+	allocateRegisters(9, d.registers)
+	*d.registers = append(*d.registers, IntVal(0))
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i + 2 < len(inbox); i += 3 {
+			triple := []Value{inbox[i], inbox[i + 1], inbox[i + 2]}
+			sortValues(triple)
+			expected = append(expected, triple...)
+		}
+		return expected
+	})
 }
 
 /*
 Level 29: Storage Floor
-... */
+Imagine each thing in the INBOX is an address. And each address refers to a tile
+0-9 on the floor. Your task: For each address in the INBOX, pick up the letter at
+that address and OUTBOX it.
+
+Congratulations! You can now access tiles on the floor INDIRECTLY! */
 func Level29(d data) {
-	
+	*d.goal = INFO{size: 5, steps: 25}
+	floor := "NKAERDOLJI"
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 5, IntegerSlice(0, 9, 1)))
+	} else {
+		inbox = generateInputs(1, IntegerSlice(0, 9, 1))
+	}
+	for _, c := range floor {
+		*d.registers = append(*d.registers, CharVal(c))
+	}
+	allocateRegisters(6, d.registers)
+	d.addInputs(inbox, 5, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for i := 0; i < len(inbox); i += 1 {
+			expected = append(expected, CharVal(rune(floor[inbox[i].Int])))
+		}
+		return expected
+	})
 }
 
 /*
 Level 30: String Storage Floor
-... */
+Each thing in the INBOX is an address of a tile on the floor. For each address
+provided in the INBOX, OUTBOX the requested item from the floor and ALL FOLLOWING
+items on the floor until you reach a ZERO. Repeat! */
 func Level30(d data) {
-	
+	*d.goal = INFO{size: 7, steps: 203}
+	floor := zeroTerminated(
+		stringValues("AXE"),
+		stringValues("TAKE"),
+		stringValues("GET"),
+		stringValues("PETAL"),
+		stringValues("TAR"),
+	)
+	allocateRegisters(24 - len(floor), &floor)
+	floor = append(floor, IntVal(0))
+	addresses := make([]Value, 0)
+	words := make([]Value, 0)
+	for i, tile := range floor {
+		if tile.Type != VAL_CHAR {
+			continue
+		}
+		addresses = append(addresses, IntVal(i))
+		if i == 0 || floor[i - 1].Type != VAL_CHAR {
+			words = append(words, IntVal(i))
+		}
+	}
+	inbox := chunks(addresses, 1)
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 3, words))
+	}
+	*d.registers = floor
+	d.addInputs(inbox, 3, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, address := range inbox {
+			for j := address.Int; floor[j].Type == VAL_CHAR; j += 1 {
+				expected = append(expected, floor[j])
+			}
+		}
+		return expected
+	})
 }
 
 /*
 Level 31: String Reverse
-... */
+For each zero terminated string in the INBOX, reverse it and put the result in
+the OUTBOX. Repeat! */
 func Level31(d data) {
-	
+	*d.goal = INFO{size: 11, steps: 122}
+	var strings inputs
+	if d.random() {
+		strings = each(randomStrings(d.rng, 3, 1, 5, GAME_LETTERS)...)
+	} else {
+		strings = chain(
+			product(2, ALPHABET[:5]),
+			each(stringValues("A"), stringValues("BRAINS"), stringValues("REVERSED")),
+		)
+	}
+	allocateRegisters(14, d.registers)
+	*d.registers = append(*d.registers, IntVal(0))
+	d.addStrings(strings, 3, func(s []Value) []Value {
+		expected := make([]Value, 0, len(s))
+		for i := len(s) - 1; i >= 0; i -= 1 {
+			expected = append(expected, s[i])
+		}
+		return expected
+	})
 }
 
 /*
 Level 32: Inventory Report
-... */
+For each thing in the INBOX, send to the OUTBOX the total number of matching
+items on the FLOOR. */
 func Level32(d data) {
-	
+	*d.goal = INFO{size: 16, steps: 393}
+	floor := stringValues("BCXABAXCBAXBCB")
+	inbox := chunks(stringValues("ABCXZ"), 1)
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, stringValues("ABCX")))
+	}
+	*d.registers = append(floor, IntVal(0), EmptyVal(), EmptyVal(), EmptyVal(), EmptyVal())
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, item := range inbox {
+			count := 0
+			for _, tile := range floor {
+				if tile == item {
+					count += 1
+				}
+			}
+			expected = append(expected, IntVal(count))
+		}
+		return expected
+	})
 }
 
 /* Level 33: Where's Carol? (Cutscene) */
 
 /*
 Level 34: Vowel Incinerator
-... */
+Send everything from the INBOX to the OUTBOX except the vowels. */
 func Level34(d data) {
-	
+	*d.goal = INFO{size: 13, steps: 323}
+	vowels := stringValues("AEIOU")
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 10, GAME_LETTERS))
+	} else {
+		inbox = generateInputs(1, RuneSlice('A', 'Z'))
+	}
+	*d.registers = append(vowels, IntVal(0))
+	allocateRegisters(4, d.registers)
+	d.addInputs(inbox, 10, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, x := range inbox {
+			if !containsValue(vowels, x) {
+				expected = append(expected, x)
+			}
+		}
+		return expected
+	})
 }
 
 /*
 Level 35: Duplicate Removal
-... */
+Send everything from the INBOX to the OUTBOX, unless you've seen the same value
+before. Discard any duplicates. */
 func Level35(d data) {
-	
+	*d.goal = INFO{size: 17, steps: 167}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 15, RuneSlice('A', 'H')))
+	} else {
+		inbox = generateInputs(2, ALPHABET[:6])
+	}
+	allocateRegisters(14, d.registers)
+	*d.registers = append(*d.registers, IntVal(0))
+	// Values are only duplicates within a case
+	d.addInputs(inbox, 8, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, x := range inbox {
+			if !containsValue(expected, x) {
+				expected = append(expected, x)
+			}
+		}
+		return expected
+	})
 }
 
 /*
 Level 36: Alphabetizer
-... */
+The INBOX contains exactly two words. Determine which word comes first, if you
+were to order them alphabetically, and send only that word to the OUTBOX. */
 func Level36(d data) {
-	
+	*d.goal = INFO{size: 39, steps: 109}
+	var words [][]Value
+	if d.random() {
+		words = randomStrings(d.rng, 2, 1, 6, GAME_LETTERS)
+	} else {
+		// Every pair of words, so that either may come first: words which
+		// differ early or late, prefixes of each other, equal words, and
+		// single letters
+		vocabulary := []string{"A", "B", "AB", "BA", "BRAIN", "BRAINS", "BRAINY", "ZOO"}
+		for _, first := range vocabulary {
+			for _, second := range vocabulary {
+				words = append(words, stringValues(first), stringValues(second))
+			}
+		}
+	}
+	allocateRegisters(23, d.registers)
+	*d.registers = append(*d.registers, IntVal(0), IntVal(10))
+	// The game's inbox holds exactly two words
+	d.addGroups(each(words...), 2, func(pair [][]Value) testCase {
+		first, second := pair[0], pair[1]
+		if compareStrings(first, second) <= 0 {
+			return testCase{zeroTerminated(first, second), first}
+		}
+		return testCase{zeroTerminated(first, second), second}
+	})
 }
 
 /*
 Level 37: Scavenger Chain
-... */
+Each pair on the floor contains:
+1. data
+2. the address of another one of the pairs
+
+A scrambled chain! Each thing in the INBOX is an address of one of the pairs.
+OUTBOX the data for that pair, and also the data in all following pairs in the
+chain. The chain ends when you reach a negative address. Repeat until the INBOX
+is empty. */
 func Level37(d data) {
-	
+	*d.goal = INFO{size: 8, steps: 63}
+	floor := make([]Value, 0)
+	allocateRegisters(25, &floor)
+	// Pairs are laid out out of order on the floor, linked by address
+	chain := []struct {
+		address int
+		data rune
+		next int
+	}{
+		{0, 'E', 13},
+		{3, 'C', 23},
+		{10, 'P', 20},
+		{13, 'A', 3},
+		{20, 'S', -1},
+		{23, 'K', 10},
+	}
+	for _, pair := range chain {
+		floor[pair.address] = CharVal(pair.data)
+		floor[pair.address + 1] = IntVal(pair.next)
+	}
+	addresses := make([]Value, 0, len(chain))
+	for _, pair := range chain {
+		addresses = append(addresses, IntVal(pair.address))
+	}
+	inbox := chunks(addresses, 1)
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 3, addresses))
+	}
+	*d.registers = floor
+	d.addInputs(inbox, 3, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, address := range inbox {
+			for addr := address.Int; addr >= 0; addr = floor[addr + 1].Int {
+				expected = append(expected, floor[addr])
+			}
+		}
+		return expected
+	})
 }
 
 /*
 Level 38: Digit Exploder
-... */
+Grab each number from the INBOX, and send its digits to the OUTBOX. For example,
+123 becomes 1, 2, 3. */
 func Level38(d data) {
-	
+	*d.goal = INFO{size: 30, steps: 165}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, IntegerSlice(0, 999, 1)))
+	} else {
+		inbox = generateInputs(1, IntegerSlice(0, 120, 1), IntegerSlice(900, 999, 9))
+	}
+	allocateRegisters(9, d.registers)
+	*d.registers = append(*d.registers, IntVal(0), IntVal(10), IntVal(100))
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, x := range inbox {
+			n := x.Int
+			if n >= 100 {
+				expected = append(expected, IntVal(n / 100))
+			}
+			if n >= 10 {
+				expected = append(expected, IntVal(n / 10 % 10))
+			}
+			expected = append(expected, IntVal(n % 10))
+		}
+		return expected
+	})
 }
 
 /*
 Level 39: Re-Coordinator
-... */
+Each number in the INBOX is an address of a tile on the floor. Send to the OUTBOX
+the coordinates of that tile, column first, row second.
+
+For example, an address of 6 has coordinates 2, 1. You may find some helpful
+items on the floor. */
 func Level39(d data) {
-	
+	*d.goal = INFO{size: 14, steps: 76}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 5, IntegerSlice(0, 15, 1)))
+	} else {
+		inbox = generateInputs(1, IntegerSlice(0, 15, 1))
+	}
+	allocateRegisters(14, d.registers)
+	*d.registers = append(*d.registers, IntVal(0), IntVal(4))
+	d.addInputs(inbox, 5, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, x := range inbox {
+			expected = append(expected, IntVal(x.Int % 4), IntVal(x.Int / 4))
+		}
+		return expected
+	})
 }
 
 /*
 Level 40: Prime Factory
-... */
+For each thing in the INBOX, send its PRIME FACTORS to the OUTBOX in order from
+smallest to largest. */
 func Level40(d data) {
-	
+	*d.goal = INFO{size: 28, steps: 399}
+	var inbox inputs
+	if d.random() {
+		inbox = each(randomInputs(d.rng, 4, IntegerSlice(2, 60, 1)))
+	} else {
+		inbox = generateInputs(1, IntegerSlice(2, 60, 1))
+	}
+	allocateRegisters(24, d.registers)
+	*d.registers = append(*d.registers, IntVal(0))
+	d.addInputs(inbox, 4, func(inbox []Value) []Value {
+		expected := make([]Value, 0)
+		for _, x := range inbox {
+			n := x.Int
+			for factor := 2; n > 1; {
+				if n % factor == 0 {
+					expected = append(expected, IntVal(factor))
+					n /= factor
+				} else {
+					factor += 1
+				}
+			}
+		}
+		return expected
+	})
 }
 
 /*
 Level 41: Sorting Floor
-... */
+For each zero terminated string in the INBOX, SORT the contents of the string,
+smallest first, biggest last, and put the results in the OUTBOX. Repeat for each
+string! */
 func Level41(d data) {
-	
+	*d.goal = INFO{size: 34, steps: 714}
+	var strings inputs
+	if d.random() {
+		// Each string is either all numbers or all letters
+		random := make([][]Value, 0)
+		for i := 0; i < 4; i += 1 {
+			pool := nonZero(GAME_INTEGERS)
+			if d.rng.Intn(2) == 0 {
+				pool = GAME_LETTERS
+			}
+			random = append(random, randomStrings(d.rng, 1, 1, 6, pool)...)
+		}
+		strings = each(random...)
+	} else {
+		strings = chain(
+			product(3, IntegerSlice(1, 3, 1)),
+			product(2, ALPHABET[:3]),
+			each([]Value{IntVal(5)}, IntegerSlice(8, -7, -3), stringValues("SORTING")),
+		)
+	}
+	allocateRegisters(24, d.registers)
+	*d.registers = append(*d.registers, IntVal(0))
+	d.addStrings(strings, 4, func(s []Value) []Value {
+		sorted := append([]Value{}, s...)
+		sortValues(sorted)
+		return sorted
+	})
 }
 
 /* Level 42: End Program. Congratulations. */
@@ -0,0 +1,125 @@
+package hrm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+/* Programs which are wrong, but which pass a level whose cases hold only
+one input each. */
+var WRONG_PROGRAMS = []struct {
+	level int
+	source string
+}{
+	{1, `
+    INBOX
+    OUTBOX
+`},
+	{8, `
+    INBOX
+    COPYTO 0
+    ADD 0
+    ADD 0
+    OUTBOX
+`},
+	// Never resets its accumulator on tile 9
+	{20, `
+a:
+    INBOX
+    COPYTO 0
+    INBOX
+    COPYTO 1
+b:
+    COPYFROM 1
+    JUMPZ c
+    BUMPDN 1
+    COPYFROM 9
+    ADD 0
+    COPYTO 9
+    JUMP b
+c:
+    COPYFROM 9
+    OUTBOX
+    JUMP a
+`},
+	// Always sends the second word
+	{36, `
+a:
+    INBOX
+    JUMPZ b
+    JUMP a
+b:
+    INBOX
+    JUMPZ c
+    OUTBOX
+    JUMP b
+c:
+`},
+}
+
+/* Compiles a program, failing the test if it does not compile. */
+func compileTest(t testing.TB, source string) *Program {
+	program, diagnostics := Compile(source)
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	return program
+}
+
+func TestSolutionsPass(t *testing.T) {
+	paths, err := filepath.Glob("../levels/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		level, err := strconv.Atoi(filepath.Base(path))
+		if err != nil {
+			continue
+		}
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Check(level, compileTest(t, string(source))); err != nil {
+			t.Errorf("Level %d: %v", level, err)
+		}
+	}
+}
+
+func TestWrongProgramsFail(t *testing.T) {
+	for _, test := range WRONG_PROGRAMS {
+		t.Run(fmt.Sprintf("Level%d", test.level), func(t *testing.T) {
+			if _, err := Check(test.level, compileTest(t, test.source)); err == nil {
+				t.Errorf("Level %d passed a wrong program.", test.level)
+			}
+		})
+	}
+}
+
+/* Grouping must not hold the inputs in memory: there are 1.5 billion
+4-tuples of large integers, so this only returns if the groups are made
+as the tuples are generated. */
+func TestInputsStream(t *testing.T) {
+	cases := make([]testCase, 0)
+	d := data{cases: func(c testCase) bool {
+		cases = append(cases, c)
+		return len(cases) < 3
+	}}
+	d.addInputs(generateInputs(4, LARGE_INTEGERS), 3, func(inbox []Value) []Value {
+		return inbox
+	})
+	if len(cases) != 3 {
+		t.Fatalf("Expected 3 cases, got %d.", len(cases))
+	}
+	for i, c := range cases {
+		if len(c.inbox) != 12 {
+			t.Errorf("Case %d: expected 12 values, got %d.", i + 1, len(c.inbox))
+		}
+	}
+	if last := cases[2].inbox[11]; last != IntVal(-91) {
+		t.Errorf("Expected the ninth tuple to end with -91, got %v.", last)
+	}
+}
@@ -0,0 +1,397 @@
+package hrm
+
+import (
+	"fmt"
+	"sort"
+)
+
+/* The linter looks for likely mistakes in a compiled program without
+running it. Each instruction is checked against what must be true of the
+hand and floor on every path which reaches it. */
+type linter struct {
+	instructions []instruction
+	preds [][]int
+	states []lintState
+	floor Floor
+	written map[int]bool
+	scanner *Scanner
+	warnings []Diagnostic
+}
+
+/* What must be true whenever an instruction is reached. Hand is set if
+something is always held, and tiles holds the tiles which are never empty.
+An instruction which is never visited is unreachable. */
+type lintState struct {
+	visited bool
+	hand bool
+	tiles map[int]bool
+}
+
+/* Compiles the source and checks it for likely mistakes, returning a
+warning for each one found. The floor is the floor the program starts
+with. If it is nil, tiles which the program never writes are assumed to be
+preloaded. If the source does not compile, its errors are returned. */
+func Lint(source string, floor Floor) []Diagnostic {
+	var chunk Chunk
+	chunk.Init()
+	return lint(parse(source, &chunk), &chunk, floor)
+}
+
+/* Checks a program for likely mistakes, given the parser which parsed it
+into the chunk. */
+func lint(parser *Parser, chunk *Chunk, floor Floor) []Diagnostic {
+	if len(parser.diagnostics) > 0 {
+		return parser.diagnostics
+	}
+	l := linter{
+		instructions: chunk.code,
+		floor: floor,
+		written: map[int]bool{},
+		scanner: parser.scanner,
+	}
+	for _, in := range l.instructions {
+		if in.op == OP_COPYTO && !in.indirect {
+			l.written[in.tile] = true
+		}
+	}
+	l.preds = make([][]int, len(l.instructions))
+	for i := range l.instructions {
+		for _, j := range l.successors(i) {
+			l.preds[j] = append(l.preds[j], i)
+		}
+	}
+	l.flow()
+	l.checkReachable()
+	l.checkLabels(parser)
+	l.checkComments(parser)
+	l.checkTiles()
+	l.checkStates()
+	l.checkJumps()
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		a, b := l.warnings[i], l.warnings[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return l.warnings
+}
+
+/* Reports a warning at an instruction, underlining its mnemonic. An
+instruction without a column, which is not in the source, underlines its
+whole line. */
+func (l *linter) warn(in instruction, kind ErrorKind, format string, args ...interface{}) {
+	text := l.scanner.Line(in.line)
+	column, length := in.column, len(instructionName(in.op))
+	if column == 0 {
+		column, length = 1, len(text)
+	}
+	l.warnToken(Token{Literal: text, column: column, line: in.line}, length, kind, format, args...)
+}
+
+/* Reports a warning at a token spanning length columns. */
+func (l *linter) warnToken(token Token, length int, kind ErrorKind, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, Diagnostic{
+		Line: token.line,
+		Column: token.column,
+		Length: length,
+		Kind: kind,
+		Severity: SEVERITY_WARNING,
+		Message: fmt.Sprintf(format, args...),
+		Text: l.scanner.Line(token.line),
+	})
+}
+
+/* Returns the instructions which may run after the instruction at i. */
+func (l *linter) successors(i int) []int {
+	in := l.instructions[i]
+	next := make([]int, 0, 2)
+	switch in.op {
+	case OP_HALT:
+		return next
+	case OP_JUMPZ, OP_JUMPN:
+		next = append(next, i + 1)
+		fallthrough
+	case OP_JUMP:
+		return append(next, in.target)
+	}
+	if i + 1 < len(l.instructions) {
+		next = append(next, i + 1)
+	}
+	return next
+}
+
+/* Returns the tiles which are never empty when the program starts. */
+func (l *linter) initialTiles() map[int]bool {
+	tiles := map[int]bool{}
+	if l.floor != nil {
+		for i, v := range l.floor {
+			if v.Type != VAL_EMPTY {
+				tiles[i] = true
+			}
+		}
+		return tiles
+	}
+	for _, in := range l.instructions {
+		if in.tile >= 0 && !l.written[in.tile] {
+			tiles[in.tile] = true
+		}
+	}
+	return tiles
+}
+
+/* Finds what must be true before each instruction, by following every
+path through the program until nothing more changes. */
+func (l *linter) flow() {
+	l.states = make([]lintState, len(l.instructions))
+	if len(l.instructions) == 0 {
+		return
+	}
+	l.states[0] = lintState{visited: true, tiles: l.initialTiles()}
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work) - 1]
+		work = work[:len(work) - 1]
+		out := l.transfer(l.instructions[i], l.states[i])
+		for _, j := range l.successors(i) {
+			if l.merge(j, out) {
+				work = append(work, j)
+			}
+		}
+	}
+}
+
+/* Returns the state after an instruction runs. Reading a tile or the hand
+proves it was not empty, as the program would have stopped otherwise. */
+func (l *linter) transfer(in instruction, state lintState) lintState {
+	out := lintState{visited: true, hand: state.hand, tiles: map[int]bool{}}
+	for t := range state.tiles {
+		out.tiles[t] = true
+	}
+	if in.tile >= 0 {
+		out.tiles[in.tile] = true
+	}
+	switch in.op {
+	case OP_INBOX, OP_COPYFROM, OP_ADD, OP_SUB, OP_BUMPUP, OP_BUMPDN:
+		out.hand = true
+	case OP_OUTBOX:
+		out.hand = false
+	case OP_COPYTO:
+		out.hand = true
+	}
+	return out
+}
+
+/* Merges a state into the state before the instruction at j, keeping
+only what is true of both. Returns whether the state changed. */
+func (l *linter) merge(j int, in lintState) bool {
+	state := &l.states[j]
+	if !state.visited {
+		*state = lintState{visited: true, hand: in.hand, tiles: map[int]bool{}}
+		for t := range in.tiles {
+			state.tiles[t] = true
+		}
+		return true
+	}
+	changed := false
+	if state.hand && !in.hand {
+		state.hand = false
+		changed = true
+	}
+	for t := range state.tiles {
+		if !in.tiles[t] {
+			delete(state.tiles, t)
+			changed = true
+		}
+	}
+	return changed
+}
+
+/* Warns about the first instruction of each run which is never reached. */
+func (l *linter) checkReachable() {
+	for i, in := range l.instructions {
+		if l.states[i].visited || instructionName(in.op) == "" {
+			continue
+		}
+		if i > 0 && !l.states[i - 1].visited && instructionName(l.instructions[i - 1].op) != "" {
+			continue
+		}
+		l.warn(in, WARN_UNREACHABLE, "Unreachable instruction. No path through the program leads here.")
+	}
+}
+
+/* Warns about labels which are declared but never jumped to. */
+func (l *linter) checkLabels(p *Parser) {
+	for label, token := range p.declarations {
+		if p.uses[label] == 0 {
+			l.warnToken(token, len(label), WARN_UNUSED_LABEL, "Label '%s' is never used.", label)
+		}
+	}
+}
+
+/* Warns about COMMENT instructions without a DEFINE COMMENT block, which
+the game shows as empty. */
+func (l *linter) checkComments(p *Parser) {
+	for _, c := range p.comments {
+		if c.Definition == nil {
+			l.warnToken(c.token, len(c.token.Literal), WARN_UNKNOWN_COMMENT, "Comment %d is not defined by a DEFINE COMMENT block.", c.Index)
+		}
+	}
+}
+
+/* Warns about tiles which are written by COPYTO but never read. An
+indirect read could read any tile, so no warnings are given if there is one. */
+func (l *linter) checkTiles() {
+	read := map[int]bool{}
+	for _, in := range l.instructions {
+		if in.tile < 0 || instructionName(in.op) == "" {
+			continue
+		}
+		if in.indirect && in.op != OP_COPYTO {
+			return
+		}
+		if in.indirect || in.op != OP_COPYTO {
+			read[in.tile] = true
+		}
+	}
+	for _, in := range l.instructions {
+		if in.op == OP_COPYTO && !in.indirect && !read[in.tile] {
+			l.warn(in, WARN_UNREAD_TILE, "Tile %d is written by COPYTO, but never read.", in.tile)
+		}
+	}
+}
+
+/* Warns about instructions which may use an empty hand or tile. */
+func (l *linter) checkStates() {
+	for i, in := range l.instructions {
+		state := l.states[i]
+		if !state.visited {
+			continue
+		}
+		switch in.op {
+		case OP_OUTBOX, OP_COPYTO, OP_ADD, OP_SUB:
+			if !state.hand {
+				l.warn(in, WARN_EMPTY_HAND, "Your hands may be empty at %s.", instructionName(in.op))
+			}
+		}
+		if in.tile < 0 || (in.op == OP_COPYTO && !in.indirect) || state.tiles[in.tile] {
+			continue
+		}
+		switch in.op {
+		case OP_COPYFROM, OP_COPYTO, OP_ADD, OP_SUB, OP_BUMPUP, OP_BUMPDN:
+			if in.indirect {
+				l.warn(in, WARN_EMPTY_TILE, "Tile %d may be empty when used as an address by %s.", in.tile, instructionName(in.op))
+			} else {
+				l.warn(in, WARN_EMPTY_TILE, "Tile %d may be empty when read by %s.", in.tile, instructionName(in.op))
+			}
+		}
+	}
+}
+
+/* Warns about conditional jumps whose outcome is decided by the
+instruction before them. Only jumps which cannot be reached any other
+way are checked. */
+func (l *linter) checkJumps() {
+	for i, in := range l.instructions {
+		if in.op != OP_JUMPZ && in.op != OP_JUMPN {
+			continue
+		}
+		prev, ok := l.fallsFrom(i)
+		if !ok {
+			continue
+		}
+		hand, ok := l.handAfter(prev)
+		if !ok {
+			continue
+		}
+		var taken, known bool
+		switch {
+		case hand.value != nil:
+			v := *hand.value
+			known = true
+			taken = v.Type == VAL_INT && ((in.op == OP_JUMPZ && v.Int == 0) || (in.op == OP_JUMPN && v.Int < 0))
+		case hand.zero:
+			known = true
+			taken = in.op == OP_JUMPZ
+		case hand.notZero && in.op == OP_JUMPZ, hand.notNegative && in.op == OP_JUMPN:
+			known = true
+		}
+		if !known {
+			continue
+		}
+		outcome := "never"
+		if taken {
+			outcome = "always"
+		}
+		l.warn(in, WARN_FIXED_JUMP, "%s is %s taken after %s.", instructionName(in.op), outcome, l.instructions[prev])
+	}
+}
+
+/* Returns the instruction before i, if it is the only way to reach i. */
+func (l *linter) fallsFrom(i int) (int, bool) {
+	preds := l.preds[i]
+	if i == 0 || len(preds) != 1 || preds[0] != i - 1 {
+		return 0, false
+	}
+	return i - 1, true
+}
+
+/* What is known of the hand after an instruction. */
+type handFact struct {
+	value *Value
+	zero bool
+	notZero bool
+	notNegative bool
+}
+
+/* Returns what the instruction at i guarantees about the hand. */
+func (l *linter) handAfter(i int) (handFact, bool) {
+	in := l.instructions[i]
+	switch in.op {
+	case OP_JUMPZ:
+		return handFact{notZero: true}, true
+	case OP_JUMPN:
+		return handFact{notNegative: true}, true
+	case OP_COPYFROM:
+		if v, ok := l.constantTile(in); ok {
+			return handFact{value: &v}, true
+		}
+	case OP_SUB:
+		// Subtracting the tile just copied from or to leaves zero
+		if prev, ok := l.fallsFrom(i); ok && !in.indirect {
+			before := l.instructions[prev]
+			if (before.op == OP_COPYFROM || before.op == OP_COPYTO) && !before.indirect && before.tile == in.tile {
+				return handFact{zero: true}, true
+			}
+		}
+	}
+	return handFact{}, false
+}
+
+/* Returns the value of a tile read directly by an instruction, if the
+tile is preloaded and never changed by the program. */
+func (l *linter) constantTile(in instruction) (Value, bool) {
+	if in.indirect || in.tile < 0 || in.tile >= len(l.floor) || l.floor[in.tile].Type == VAL_EMPTY {
+		return Value{}, false
+	}
+	for _, other := range l.instructions {
+		switch other.op {
+		case OP_COPYTO, OP_BUMPUP, OP_BUMPDN:
+			if other.indirect || other.tile == in.tile {
+				return Value{}, false
+			}
+		}
+	}
+	return l.floor[in.tile], true
+}
+
+/* Formats an instruction as it is written in the source, without
+the labels of jumps. */
+func (in instruction) String() string {
+	name := instructionName(in.op)
+	switch {
+	case in.tile < 0:
+		return name
+	case in.indirect:
+		return fmt.Sprintf("%s [%d]", name, in.tile)
+	default:
+		return fmt.Sprintf("%s %d", name, in.tile)
+	}
+}
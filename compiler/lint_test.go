@@ -0,0 +1,83 @@
+package hrm
+
+import (
+	"testing"
+)
+
+/* A warning expected from the linter. */
+type lintWarning struct {
+	kind ErrorKind
+	line int
+	column int
+}
+
+/* Programs with the warnings expected of them, in order. A nil floor
+assumes that tiles which are never written are preloaded. */
+var LINT_PROGRAMS = []struct {
+	name string
+	source string
+	floor Floor
+	warnings []lintWarning
+}{
+	{"Unreachable", `a:
+    INBOX
+    OUTBOX
+    JUMP a
+    INBOX
+    OUTBOX
+`, nil, []lintWarning{{WARN_UNREACHABLE, 5, 5}}},
+	{"UnusedLabel", `    INBOX
+b:
+    OUTBOX
+`, nil, []lintWarning{{WARN_UNUSED_LABEL, 2, 1}}},
+	{"UnreadTile", `    INBOX
+    COPYTO 3
+    OUTBOX
+`, nil, []lintWarning{{WARN_UNREAD_TILE, 2, 5}}},
+	{"EmptyHand", "\tOUTBOX\n", nil, []lintWarning{{WARN_EMPTY_HAND, 1, 2}}},
+	{"EmptyTile", `    COPYFROM 2
+    OUTBOX
+`, make(Floor, 4), []lintWarning{{WARN_EMPTY_TILE, 1, 5}}},
+	{"FixedJump", `    COPYFROM 0
+    JUMPZ a
+    INBOX
+a:
+    OUTBOX
+`, Floor{IntVal(0)}, []lintWarning{{WARN_FIXED_JUMP, 2, 5}}},
+	{"PreloadedTile", `    COPYFROM 0
+    OUTBOX
+`, Floor{IntVal(5)}, nil},
+	// An indirect read could read tile 3
+	{"IndirectRead", `    INBOX
+    COPYTO 3
+    COPYFROM [0]
+    OUTBOX
+`, Floor{IntVal(3), {}, {}, {}}, nil},
+	// Tile 0 is written on both paths into a
+	{"Loop", `    INBOX
+    COPYTO 0
+a:
+    COPYFROM 0
+    OUTBOX
+    INBOX
+    COPYTO 0
+    JUMP a
+`, make(Floor, 1), nil},
+}
+
+func TestLint(t *testing.T) {
+	for _, test := range LINT_PROGRAMS {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostics := Lint(test.source, test.floor)
+			if len(diagnostics) != len(test.warnings) {
+				t.Fatalf("Expected %d warnings, got %v.", len(test.warnings), diagnostics)
+			}
+			for i, d := range diagnostics {
+				got := lintWarning{d.Kind, d.Line, d.Column}
+				if got != test.warnings[i] || d.Severity != SEVERITY_WARNING {
+					t.Errorf("Expected %+v, got %+v.", test.warnings[i], d)
+				}
+			}
+		})
+	}
+}
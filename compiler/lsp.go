@@ -0,0 +1,677 @@
+package hrm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+/* An LSP server speaks the Language Server Protocol, so that editors can
+check and navigate HRM programs as they are written. Messages are read
+from in and written to out, each with a Content-Length header. */
+type lspServer struct {
+	reader *bufio.Reader
+	out io.Writer
+	documents map[string]*lspDocument
+	level int
+}
+
+/* A message sent by the client. Requests have an id, notifications do not. */
+type lspMessage struct {
+	ID json.RawMessage `json:"id,omitempty"`
+	Method string `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+/* An open document, and what was found by parsing and scanning it. Each
+version of the document is parsed once. Level is the level the program
+solves, or 0 if it is not known. */
+type lspDocument struct {
+	uri string
+	text string
+	lines []string
+	level int
+	parser *Parser
+	tokens []Token
+	declarations map[string]Token
+	uses map[string][]Token
+	names map[int]string
+	tiles map[string]int
+	tileDeclarations map[string]Token
+}
+
+/* A position in a document, counted from 0. Characters are counted in
+UTF-16 code units, as the protocol does. */
+type lspPosition struct {
+	Line int `json:"line"`
+	Character int `json:"character"`
+}
+
+/* A range in a document, from start up to but not including end. */
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End lspPosition `json:"end"`
+}
+
+/* A range in a given document. */
+type lspLocation struct {
+	URI string `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+/* The parameters of requests made at a position in a document. */
+type lspPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// Semantic token types, in the order of the legend sent to the client
+var LSP_TOKEN_TYPES = []string{"keyword", "function", "number", "comment", "operator", "variable"}
+const (
+	LSP_KEYWORD = iota
+	LSP_LABEL
+	LSP_NUMBER
+	LSP_COMMENT
+	LSP_OPERATOR
+	LSP_TILE
+)
+
+// Kinds of symbols and completions, as numbered by the protocol
+const (
+	LSP_COMPLETION_VARIABLE = 6
+	LSP_SYMBOL_FUNCTION = 12
+	LSP_COMPLETION_KEYWORD = 14
+	LSP_COMPLETION_REFERENCE = 18
+)
+
+/* Serves the Language Server Protocol until the client exits or the
+input ends. */
+func ServeLSP(in io.Reader, out io.Writer) error {
+	s := &lspServer{
+		reader: bufio.NewReader(in),
+		out: out,
+		documents: map[string]*lspDocument{},
+	}
+	for {
+		body, err := readMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var message lspMessage
+		if err := json.Unmarshal(body, &message); err != nil {
+			return err
+		}
+		if !s.handle(message) {
+			return nil
+		}
+	}
+}
+
+/* Writes a message to the client. */
+func (s *lspServer) send(message map[string]interface{}) {
+	message["jsonrpc"] = "2.0"
+	body, _ := json.Marshal(message)
+	writeMessage(s.out, body)
+}
+
+/* Responds to a request with a result. */
+func (s *lspServer) respond(message lspMessage, result interface{}) {
+	s.send(map[string]interface{}{"id": message.ID, "result": result})
+}
+
+/* Sends a notification to the client. */
+func (s *lspServer) notify(method string, params interface{}) {
+	s.send(map[string]interface{}{"method": method, "params": params})
+}
+
+/* Handles a message. Returns false once the client has exited. */
+func (s *lspServer) handle(message lspMessage) bool {
+	var params lspPositionParams
+	json.Unmarshal(message.Params, &params)
+	document := s.documents[params.TextDocument.URI]
+	switch message.Method {
+	case "initialize":
+		var init struct {
+			InitializationOptions struct {
+				Level int `json:"level"`
+			} `json:"initializationOptions"`
+		}
+		json.Unmarshal(message.Params, &init)
+		s.level = init.InitializationOptions.Level
+		s.respond(message, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": 1,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider": true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]interface{}{},
+				"semanticTokensProvider": map[string]interface{}{
+					"legend": map[string]interface{}{
+						"tokenTypes": LSP_TOKEN_TYPES,
+						"tokenModifiers": []string{},
+					},
+					"full": true,
+				},
+			},
+			"serverInfo": map[string]interface{}{"name": "hrm"},
+		})
+	case "shutdown":
+		s.respond(message, nil)
+	case "exit":
+		return false
+	case "textDocument/didOpen", "textDocument/didChange":
+		var change struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		json.Unmarshal(message.Params, &change)
+		text := change.TextDocument.Text
+		if n := len(change.ContentChanges); n > 0 {
+			// Changes are always sent as the full text of the document
+			text = change.ContentChanges[n - 1].Text
+		}
+		s.open(change.TextDocument.URI, text)
+	case "textDocument/didClose":
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri": params.TextDocument.URI,
+			"diagnostics": []interface{}{},
+		})
+	case "textDocument/definition":
+		var result interface{}
+		if document != nil {
+			if i, ok := document.tokenAt(params.Position); ok && document.isTile(i) {
+				result = document.location(document.tileDeclarations[document.tokens[i].Literal])
+			} else if token, ok := document.labelAt(params.Position); ok {
+				if declaration, ok := document.declarations[token.Literal]; ok {
+					result = document.location(declaration)
+				}
+			}
+		}
+		s.respond(message, result)
+	case "textDocument/references":
+		locations := make([]lspLocation, 0)
+		if document != nil {
+			locations = document.references(params.Position, params.Context.IncludeDeclaration)
+		}
+		s.respond(message, locations)
+	case "textDocument/hover":
+		var result interface{}
+		if document != nil {
+			if text := document.hover(params.Position); text != "" {
+				result = map[string]interface{}{
+					"contents": map[string]interface{}{"kind": "markdown", "value": text},
+				}
+			}
+		}
+		s.respond(message, result)
+	case "textDocument/completion":
+		items := make([]map[string]interface{}, 0)
+		if document != nil {
+			items = document.completion(params.Position)
+		}
+		s.respond(message, items)
+	case "textDocument/documentSymbol":
+		symbols := make([]map[string]interface{}, 0)
+		if document != nil {
+			symbols = document.symbols()
+		}
+		s.respond(message, symbols)
+	case "textDocument/semanticTokens/full":
+		data := make([]int, 0)
+		if document != nil {
+			data = document.semanticTokens()
+		}
+		s.respond(message, map[string]interface{}{"data": data})
+	default:
+		if message.ID != nil {
+			s.send(map[string]interface{}{
+				"id": message.ID,
+				"error": map[string]interface{}{
+					"code": -32601,
+					"message": fmt.Sprintf("Unsupported method '%s'.", message.Method),
+				},
+			})
+		}
+	}
+	return true
+}
+
+/* Parses and scans an opened or changed document, and publishes its
+diagnostics. */
+func (s *lspServer) open(uri string, text string) {
+	var chunk Chunk
+	chunk.Init()
+	parser := parse(text, &chunk)
+	document := &lspDocument{
+		uri: uri,
+		text: text,
+		lines: strings.Split(text, "\n"),
+		level: s.level,
+		parser: parser,
+		declarations: map[string]Token{},
+		uses: map[string][]Token{},
+		names: parser.tileNames(),
+		tiles: parser.tiles,
+		tileDeclarations: parser.tileDeclarations,
+	}
+	if document.level == 0 {
+		document.level = levelOf(uri)
+	}
+	document.scan()
+	s.documents[uri] = document
+	var floor Floor
+	if document.level != 0 {
+		floor, _ = LevelFloor(document.level)
+	}
+	diagnostics := make([]map[string]interface{}, 0)
+	for _, d := range lint(parser, &chunk, floor) {
+		severity := 1
+		if d.Severity == SEVERITY_WARNING {
+			severity = 2
+		}
+		start := document.position(d.Line, d.Column)
+		diagnostics = append(diagnostics, map[string]interface{}{
+			"range": lspRange{start, document.position(d.Line, d.Column + d.Length)},
+			"severity": severity,
+			"code": d.Kind.Code(),
+			"source": "hrm",
+			"message": d.Message,
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri": uri,
+		"diagnostics": diagnostics,
+	})
+}
+
+// The number a file name starts with
+var LEVEL_NUMBER = regexp.MustCompile(`^\d+`)
+
+/* Returns the level a document solves, from the number its file name
+starts with, as the solutions in levels/ are named. Returns 0 if the file
+name does not start with a number. */
+func levelOf(uri string) int {
+	path := uri
+	if u, err := url.Parse(uri); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	digits := LEVEL_NUMBER.FindString(filepath.Base(path))
+	level, _ := strconv.Atoi(digits)
+	return level
+}
+
+/* Scans the document for tokens, and finds where each label is declared
+and used. A label followed by a colon is a declaration, and a label after
+a jump is a use. */
+func (d *lspDocument) scan() {
+	var scanner Scanner
+	scanner.Init(d.text)
+	previous := Token{Type: NEWLINE}
+	for {
+		token := scanner.ScanToken()
+		if token.Type == EOF {
+			break
+		}
+		d.tokens = append(d.tokens, token)
+		if token.Type == LABEL {
+			switch previous.Type {
+			case JUMP, JUMPZ, JUMPN:
+				d.uses[token.Literal] = append(d.uses[token.Literal], token)
+			}
+		}
+		if token.Type == COLON && previous.Type == LABEL {
+			if _, ok := d.declarations[previous.Literal]; !ok {
+				d.declarations[previous.Literal] = previous
+			}
+		}
+		previous = token
+	}
+}
+
+/* Returns the number of UTF-16 code units needed to encode a string. */
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+/* Returns the position of a column on a line, both counted from 1 like
+those of tokens. Columns count bytes, which are converted to the UTF-16
+code units of the protocol. A column past the end of the line, such as
+that of a newline, counts one unit per byte. */
+func (d *lspDocument) position(line int, column int) lspPosition {
+	text := ""
+	if line >= 1 && line <= len(d.lines) {
+		text = d.lines[line - 1]
+	}
+	n := column - 1
+	if n > len(text) {
+		n = len(text)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return lspPosition{line - 1, utf16Length(text[:n]) + column - 1 - n}
+}
+
+/* Returns the column of a position, counted from 1 in bytes like those
+of tokens. */
+func (d *lspDocument) column(position lspPosition) int {
+	text := ""
+	if position.Line >= 0 && position.Line < len(d.lines) {
+		text = d.lines[position.Line]
+	}
+	units := 0
+	for i, r := range text {
+		if units >= position.Character {
+			return i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(text) + 1 + position.Character - units
+}
+
+/* Returns the token at a position, if any. A position just after a token
+also counts, as that is where the cursor is after typing it. */
+func (d *lspDocument) tokenAt(position lspPosition) (int, bool) {
+	column := d.column(position)
+	for i, token := range d.tokens {
+		// The literal of an error is its message, not its text
+		if token.line - 1 != position.Line || token.Type == NEWLINE || token.Type == ERROR {
+			continue
+		}
+		if token.column <= column && column <= token.column + len(token.Literal) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+/* Checks if the token at i names a tile, rather than a label. */
+func (d *lspDocument) isTile(i int) bool {
+	token := d.tokens[i]
+	if _, ok := d.tiles[token.Literal]; !ok || token.Type != LABEL {
+		return false
+	}
+	if i + 1 < len(d.tokens) && d.tokens[i + 1].Type == COLON {
+		return false
+	}
+	if i > 0 {
+		switch d.tokens[i - 1].Type {
+		case JUMP, JUMPZ, JUMPN:
+			return false
+		}
+	}
+	return true
+}
+
+/* Returns the label at a position, if any. */
+func (d *lspDocument) labelAt(position lspPosition) (Token, bool) {
+	i, ok := d.tokenAt(position)
+	if !ok || d.tokens[i].Type != LABEL {
+		return Token{}, false
+	}
+	return d.tokens[i], true
+}
+
+/* Returns the location of a token. */
+func (d *lspDocument) location(token Token) lspLocation {
+	start := d.position(token.line, token.column)
+	end := d.position(token.line, token.column + len(token.Literal))
+	return lspLocation{d.uri, lspRange{start, end}}
+}
+
+/* Returns every use of the label at a position, and its declaration if
+asked for. */
+func (d *lspDocument) references(position lspPosition, declaration bool) []lspLocation {
+	locations := make([]lspLocation, 0)
+	label, ok := d.labelAt(position)
+	if !ok {
+		return locations
+	}
+	if token, ok := d.declarations[label.Literal]; ok && declaration {
+		locations = append(locations, d.location(token))
+	}
+	for _, token := range d.uses[label.Literal] {
+		locations = append(locations, d.location(token))
+	}
+	return locations
+}
+
+/* Returns the hover text for the token at a position: the description of
+an instruction, the declaration of a label, or the preloaded value of a
+tile. */
+func (d *lspDocument) hover(position lspPosition) string {
+	i, ok := d.tokenAt(position)
+	if !ok {
+		return ""
+	}
+	token := d.tokens[i]
+	switch token.Type {
+	case INBOX, OUTBOX, JUMP, JUMPZ, JUMPN, COPYFROM, COPYTO, ADD, SUB, BUMPUP, BUMPDN, COMMENT:
+		return fmt.Sprintf("**%s**\n\n%s", token.Literal, INSTRUCTION_DOCS[token.Literal])
+	case LABEL:
+		if d.isTile(i) {
+			return d.tileHover(d.tiles[token.Literal])
+		}
+		if declaration, ok := d.declarations[token.Literal]; ok {
+			return fmt.Sprintf("Label `%s`, declared on line %d. Used by %d jump(s).",
+				token.Literal, declaration.line, len(d.uses[token.Literal]))
+		}
+		return fmt.Sprintf("Unknown label `%s`.", token.Literal)
+	case INT:
+		n, _ := strconv.Atoi(token.Literal)
+		if i > 0 && d.tokens[i - 1].Type == COMMENT {
+			return d.commentHover(n)
+		}
+		if i > 0 && d.tokens[i - 1].line == token.line {
+			return d.tileHover(n)
+		}
+	}
+	return ""
+}
+
+/* Returns the hover text for a COMMENT n instruction, from its DEFINE
+COMMENT block. */
+func (d *lspDocument) commentHover(index int) string {
+	var definition *Definition
+	for _, c := range d.parser.definitions {
+		if c.Kind == DEFINE_COMMENT && c.Index == index {
+			c := c
+			definition = &c
+		}
+	}
+	switch {
+	case definition == nil:
+		return fmt.Sprintf("Comment %d is not defined by a DEFINE COMMENT block.", index)
+	case definition.Points == nil:
+		return fmt.Sprintf("Comment %d, defined on line %d. Its drawing could not be decoded.", index, definition.Line)
+	}
+	return fmt.Sprintf("Comment %d, defined on line %d. Drawn with %d point(s).", index, definition.Line, len(definition.Points))
+}
+
+/* Returns the hover text for a tile, with its name and preloaded value. */
+func (d *lspDocument) tileHover(tile int) string {
+	text := fmt.Sprintf("Tile %d", tile)
+	if name, ok := d.names[tile]; ok {
+		text += fmt.Sprintf(" (%s)", name)
+	}
+	if d.level == 0 {
+		return text
+	}
+	floor, err := LevelFloor(d.level)
+	switch {
+	case err != nil:
+		return text
+	case tile >= len(floor):
+		return text + fmt.Sprintf("\n\nLevel %d only has %d tiles.", d.level, len(floor))
+	case floor[tile].Type == VAL_EMPTY:
+		return text + fmt.Sprintf("\n\nEmpty when level %d starts.", d.level)
+	}
+	return text + fmt.Sprintf("\n\nPreloaded with `%s` in level %d.", valueText(floor[tile]), d.level)
+}
+
+/* Returns the completions at a position. After a jump, only labels are
+offered. At the start of a line, instructions are offered. */
+func (d *lspDocument) completion(position lspPosition) []map[string]interface{} {
+	items := make([]map[string]interface{}, 0)
+	prefix := ""
+	if position.Line >= 0 && position.Line < len(d.lines) {
+		line := d.lines[position.Line]
+		if n := d.column(position) - 1; n < len(line) {
+			line = line[:n]
+		}
+		prefix = line
+	}
+	fields := strings.Fields(prefix)
+	jumping := len(fields) > 0 && (fields[0] == "JUMP" || fields[0] == "JUMPZ" || fields[0] == "JUMPN")
+	if jumping && (len(fields) > 1 || strings.HasSuffix(prefix, " ")) {
+		labels := make([]string, 0, len(d.declarations))
+		for label := range d.declarations {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			items = append(items, map[string]interface{}{
+				"label": label,
+				"kind": LSP_COMPLETION_REFERENCE,
+				"detail": fmt.Sprintf("Label on line %d", d.declarations[label].line),
+			})
+		}
+		return items
+	}
+	memory := len(fields) > 0 && (fields[0] == "COPYFROM" || fields[0] == "COPYTO" || fields[0] == "ADD" ||
+		fields[0] == "SUB" || fields[0] == "BUMPUP" || fields[0] == "BUMPDN")
+	if memory && (len(fields) > 1 || strings.HasSuffix(prefix, " ")) {
+		names := make([]string, 0, len(d.tiles))
+		for name := range d.tiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			items = append(items, map[string]interface{}{
+				"label": name,
+				"kind": LSP_COMPLETION_VARIABLE,
+				"detail": fmt.Sprintf("Tile %d", d.tiles[name]),
+			})
+		}
+		return items
+	}
+	if len(fields) > 1 || (len(fields) == 1 && strings.HasSuffix(prefix, " ")) {
+		return items
+	}
+	keywords := make([]string, 0, len(INSTRUCTION_DOCS))
+	for keyword := range INSTRUCTION_DOCS {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		items = append(items, map[string]interface{}{
+			"label": keyword,
+			"kind": LSP_COMPLETION_KEYWORD,
+			"documentation": INSTRUCTION_DOCS[keyword],
+		})
+	}
+	return items
+}
+
+/* Returns a symbol for each label declared. */
+func (d *lspDocument) symbols() []map[string]interface{} {
+	symbols := make([]map[string]interface{}, 0, len(d.declarations))
+	for label, token := range d.declarations {
+		location := d.location(token)
+		symbols = append(symbols, map[string]interface{}{
+			"name": label,
+			"kind": LSP_SYMBOL_FUNCTION,
+			"range": location.Range,
+			"selectionRange": location.Range,
+		})
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i]["range"].(lspRange).Start.Line < symbols[j]["range"].(lspRange).Start.Line
+	})
+	return symbols
+}
+
+/* Returns the semantic tokens of the document, encoded relative to each
+other as the protocol expects. */
+func (d *lspDocument) semanticTokens() []int {
+	type semantic struct {
+		line, start, length, kind int
+	}
+	semantics := make([]semantic, 0, len(d.tokens))
+	for i, token := range d.tokens {
+		kind := -1
+		switch token.Type {
+		case INBOX, OUTBOX, JUMP, JUMPZ, JUMPN, COPYFROM, COPYTO, ADD, SUB, BUMPUP, BUMPDN, COMMENT, TILE:
+			kind = LSP_KEYWORD
+		case LABEL:
+			kind = LSP_LABEL
+			if d.isTile(i) {
+				kind = LSP_TILE
+			}
+		case INT:
+			kind = LSP_NUMBER
+		case MINUS, COLON, LEFT_BRACKET, RIGHT_BRACKET, EQUAL:
+			kind = LSP_OPERATOR
+		case LINE_COMMENT:
+			kind = LSP_COMMENT
+		case DEFINE:
+			// Tokens may not span lines, so each line of the block is a token
+			for j, line := range strings.Split(token.Literal, "\n") {
+				start := token.column - 1
+				if j > 0 {
+					start = len(line) - len(strings.TrimLeft(line, " \t"))
+				}
+				if text := strings.TrimSpace(line); text != "" {
+					semantics = append(semantics, semantic{token.line - 1 + j, start, len(text), LSP_COMMENT})
+				}
+			}
+		}
+		if kind >= 0 {
+			semantics = append(semantics, semantic{token.line - 1, token.column - 1, len(token.Literal), kind})
+		}
+	}
+	sort.Slice(semantics, func(i, j int) bool {
+		a, b := semantics[i], semantics[j]
+		return a.line < b.line || (a.line == b.line && a.start < b.start)
+	})
+	data := make([]int, 0, 5 * len(semantics))
+	line, start := 0, 0
+	for _, s := range semantics {
+		if s.line != line {
+			start = 0
+		}
+		// Semantics are found in bytes, but sent in UTF-16 code units
+		from := d.position(s.line + 1, s.start + 1).Character
+		to := d.position(s.line + 1, s.start + 1 + s.length).Character
+		data = append(data, s.line - line, from - start, to - from, s.kind, 0)
+		line, start = s.line, from
+	}
+	return data
+}
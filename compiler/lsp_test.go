@@ -0,0 +1,233 @@
+package hrm
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/* An LSP client for tests, which sends requests and notifications to a
+server and reads its responses and notifications in order. */
+type lspClient struct {
+	t *testing.T
+	in *io.PipeWriter
+	messages chan lspReply
+	id int
+}
+
+/* A response or notification sent by the server. */
+type lspReply struct {
+	ID *int `json:"id"`
+	Method string `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Params json.RawMessage `json:"params"`
+}
+
+/* Starts an LSP server, returning a client connected to it. */
+func newLspClient(t *testing.T) *lspClient {
+	requests, in := io.Pipe()
+	out, responses := io.Pipe()
+	go ServeLSP(requests, responses)
+	c := &lspClient{t, in, make(chan lspReply, 16), 0}
+	go func() {
+		reader := bufio.NewReader(out)
+		for {
+			body, err := readMessage(reader)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var reply lspReply
+			json.Unmarshal(body, &reply)
+			c.messages <- reply
+		}
+	}()
+	return c
+}
+
+/* Sends a message, which is a request if it has an id. */
+func (c *lspClient) send(id *int, method string, params interface{}) {
+	message := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != nil {
+		message["id"] = *id
+	}
+	body, _ := json.Marshal(message)
+	if err := writeMessage(c.in, body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+/* Waits for a message matching a test, skipping any other messages.
+Fails the test if none arrives within a second. */
+func (c *lspClient) wait(name string, matches func(lspReply) bool) lspReply {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case reply, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("The server closed before %s.", name)
+			}
+			if matches(reply) {
+				return reply
+			}
+		case <-timeout:
+			c.t.Fatalf("Timed out waiting for %s.", name)
+		}
+	}
+}
+
+/* Sends a request, and decodes the result of its response into result. */
+func (c *lspClient) request(method string, params interface{}, result interface{}) {
+	c.id += 1
+	id := c.id
+	c.send(&id, method, params)
+	reply := c.wait(method, func(r lspReply) bool { return r.ID != nil && *r.ID == id })
+	if err := json.Unmarshal(reply.Result, result); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+/* Sends a notification. */
+func (c *lspClient) notify(method string, params interface{}) {
+	c.send(nil, method, params)
+}
+
+/* Waits for a notification, and decodes its parameters into params. */
+func (c *lspClient) expect(method string, params interface{}) {
+	reply := c.wait(method, func(r lspReply) bool { return r.ID == nil && r.Method == method })
+	if err := json.Unmarshal(reply.Params, params); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+/* A diagnostic as published to the client. */
+type lspDiagnostic struct {
+	Range lspRange `json:"range"`
+	Severity int `json:"severity"`
+	Code string `json:"code"`
+}
+
+/* Opens a document, returning the diagnostics published for it. */
+func (c *lspClient) open(uri string, text string) []lspDiagnostic {
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "hrm", "version": 1, "text": text},
+	})
+	var published struct {
+		URI string `json:"uri"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	c.expect("textDocument/publishDiagnostics", &published)
+	if published.URI != uri {
+		c.t.Fatalf("Expected diagnostics for %s, got %s.", uri, published.URI)
+	}
+	return published.Diagnostics
+}
+
+/* Returns the parameters of a request at a position in a document. */
+func positionParams(uri string, line int, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position": lspPosition{line, character},
+		"context": map[string]interface{}{"includeDeclaration": true},
+	}
+}
+
+/* Starts an LSP server and initializes it. */
+func startLsp(t *testing.T) *lspClient {
+	c := newLspClient(t)
+	var result map[string]interface{}
+	c.request("initialize", map[string]interface{}{}, &result)
+	return c
+}
+
+// A program for level 20, whose floor has 0 on tile 9
+const LSP_URI = "file:///tmp/20-lsp"
+const LSP_SOURCE = `a:
+    INBOX
+    COPYTO 1
+    COPYFROM 9
+    OUTBOX
+    JUMP a
+`
+
+func TestLspNavigation(t *testing.T) {
+	c := startLsp(t)
+	defer c.in.Close()
+	c.open(LSP_URI, LSP_SOURCE)
+	declaration := lspLocation{LSP_URI, lspRange{lspPosition{0, 0}, lspPosition{0, 1}}}
+	jump := lspLocation{LSP_URI, lspRange{lspPosition{5, 9}, lspPosition{5, 10}}}
+	var location lspLocation
+	c.request("textDocument/definition", positionParams(LSP_URI, 5, 10), &location)
+	if location != declaration {
+		t.Errorf("Expected the definition %+v, got %+v.", declaration, location)
+	}
+	var locations []lspLocation
+	c.request("textDocument/references", positionParams(LSP_URI, 0, 0), &locations)
+	if !reflect.DeepEqual(locations, []lspLocation{declaration, jump}) {
+		t.Errorf("Expected the references %+v, got %+v.", []lspLocation{declaration, jump}, locations)
+	}
+	hovers := []struct {
+		line int
+		character int
+		text string
+	}{
+		{1, 6, "**INBOX**\n\n" + INSTRUCTION_DOCS["INBOX"]},
+		{3, 14, "Tile 9\n\nPreloaded with `0` in level 20."},
+		{5, 9, "Label `a`, declared on line 1. Used by 1 jump(s)."},
+	}
+	for _, test := range hovers {
+		var hover struct {
+			Contents struct {
+				Kind string `json:"kind"`
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		c.request("textDocument/hover", positionParams(LSP_URI, test.line, test.character), &hover)
+		if hover.Contents.Kind != "markdown" || hover.Contents.Value != test.text {
+			t.Errorf("Hover at %d:%d: expected %q, got %+v.", test.line, test.character, test.text, hover.Contents)
+		}
+	}
+}
+
+func TestLspDiagnostics(t *testing.T) {
+	c := startLsp(t)
+	defer c.in.Close()
+	// Tile 1 is written but never read
+	expected := []lspDiagnostic{{lspRange{lspPosition{2, 4}, lspPosition{2, 10}}, 2, WARN_UNREAD_TILE.Code()}}
+	if diagnostics := c.open(LSP_URI, LSP_SOURCE); !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("Expected %+v, got %+v.", expected, diagnostics)
+	}
+	expected = []lspDiagnostic{{lspRange{lspPosition{1, 9}, lspPosition{1, 13}}, 1, ERR_UNKNOWN_LABEL.Code()}}
+	if diagnostics := c.open(LSP_URI, "    INBOX\n    JUMP nope\n"); !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("Expected %+v, got %+v.", expected, diagnostics)
+	}
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]interface{}{"uri": LSP_URI}})
+	var published struct {
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	c.expect("textDocument/publishDiagnostics", &published)
+	if len(published.Diagnostics) != 0 {
+		t.Errorf("Expected closing to clear the diagnostics, got %+v.", published.Diagnostics)
+	}
+}
+
+/* Positions count UTF-16 code units, so a character outside the Basic
+Multilingual Plane counts twice, though it takes four bytes. */
+func TestLspUtf16(t *testing.T) {
+	c := startLsp(t)
+	defer c.in.Close()
+	uri := "file:///tmp/emoji"
+	diagnostics := c.open(uri, "a:\n\U0001F600 JUMP a\n")
+	if len(diagnostics) != 1 || diagnostics[0].Code != ERR_UNEXPECTED_CHARACTER.Code() || diagnostics[0].Range.Start != (lspPosition{1, 0}) {
+		t.Errorf("Expected an unexpected character at the start of line 2, got %+v.", diagnostics)
+	}
+	var locations []lspLocation
+	c.request("textDocument/references", positionParams(uri, 1, 8), &locations)
+	jump := lspLocation{uri, lspRange{lspPosition{1, 8}, lspPosition{1, 9}}}
+	if len(locations) != 2 || locations[1] != jump {
+		t.Errorf("Expected the jump to be at %+v, got %+v.", jump.Range, locations)
+	}
+}
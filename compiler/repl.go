@@ -0,0 +1,271 @@
+package hrm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const REPL_HELP = `Commands:
+  step, s                   Run one instruction
+  next, n                   Run until an instruction further down, finishing loops
+  continue, c               Run until a breakpoint, watch or condition stops
+  reverse-step, rs          Run one instruction backwards
+  reverse-continue, rc      Run backwards until a breakpoint, watch or condition stops
+  until, u <line|label>     Run until a line or label is reached
+  break, b <line|label>     Stop before the instruction on a line or at a label
+  delete, d <line|label>    Remove a breakpoint
+  watch, w <tile>           Stop when a tile, given by number or name, is written
+  unwatch <tile>            Stop watching a tile
+  cond <hand|tile> <op> <value>
+                            Stop when a condition becomes true, such as 'hand == 0'
+  uncond <n>                Remove condition n
+  info, i                   List breakpoints, watches and conditions
+  print, p [hand|inbox|outbox|floor|<tile>]
+                            Print the state of the program, or all of it
+  list, l                   List the source around the current line
+  disassemble, x            Disassemble the current instruction
+  restart, r                Run the program again from the start
+  help, h                   Show this message
+  quit, q                   Leave the debugger
+An empty line repeats the last command.`
+
+/* Runs an interactive debugging session, reading commands from in and
+writing to out until the input ends or the user quits. */
+func (d *Debugger) Repl(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	last := ""
+	d.where(out)
+	for {
+		fmt.Fprintf(out, "(hrm) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !d.command(out, fields[0], fields[1:]) {
+			return
+		}
+	}
+}
+
+/* Runs a single command. Returns false if the user quit. */
+func (d *Debugger) command(out io.Writer, name string, args []string) bool {
+	var err error
+	switch name {
+	case "step", "s":
+		d.stopped(out, d.Step())
+	case "next", "n":
+		d.stopped(out, d.Next())
+	case "continue", "c":
+		d.stopped(out, d.Continue())
+	case "reverse-step", "rs":
+		d.stopped(out, d.ReverseStep())
+	case "reverse-continue", "rc":
+		d.stopped(out, d.ReverseContinue())
+	case "until", "u":
+		if err = expectArgs(args, 1); err == nil {
+			var stop Stop
+			if stop, err = d.RunTo(args[0]); err == nil {
+				d.stopped(out, stop)
+			}
+		}
+	case "break", "b":
+		if err = expectArgs(args, 1); err == nil {
+			var line int
+			if line, err = d.Break(args[0]); err == nil {
+				fmt.Fprintf(out, "Breakpoint set at line %d.\n", line)
+			}
+		}
+	case "delete", "d":
+		if err = expectArgs(args, 1); err == nil {
+			err = d.Clear(args[0])
+		}
+	case "watch", "w", "unwatch":
+		var tile int
+		if err = expectArgs(args, 1); err == nil {
+			tile, err = d.Tile(args[0])
+		}
+		if err == nil {
+			if name == "unwatch" {
+				err = d.Unwatch(tile)
+			} else if err = d.Watch(tile); err == nil {
+				fmt.Fprintf(out, "Watching tile %d.\n", tile)
+			}
+		}
+	case "cond":
+		if err = d.BreakIf(strings.Join(args, " ")); err == nil {
+			fmt.Fprintf(out, "Condition %d: %s\n", len(d.conditions), d.conditions[len(d.conditions) - 1].text)
+		}
+	case "uncond":
+		var n int
+		if n, err = tileArg(args); err == nil {
+			err = d.RemoveCondition(n)
+		}
+	case "info", "i":
+		d.info(out)
+	case "print", "p":
+		err = d.print(out, args)
+	case "list", "l":
+		d.list(out, 3)
+	case "disassemble", "x":
+		d.disassemble(out)
+	case "restart", "r":
+		d.Restart()
+		d.where(out)
+	case "help", "h":
+		fmt.Fprintln(out, REPL_HELP)
+	case "quit", "q":
+		return false
+	default:
+		err = fmt.Errorf("Unknown command '%s'. Type 'help' for a list of commands.", name)
+	}
+	if err != nil {
+		fmt.Fprintln(out, err.Error())
+	}
+	return true
+}
+
+/* Checks that a command was given the expected number of arguments. */
+func expectArgs(args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("Expected %d argument(s), got %d.", n, len(args))
+	}
+	return nil
+}
+
+/* Parses the single number argument of a command. */
+func tileArg(args []string) (int, error) {
+	if err := expectArgs(args, 1); err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("Expected a number, not '%s'.", args[0])
+	}
+	return n, nil
+}
+
+/* Prints why the program stopped, and where. */
+func (d *Debugger) stopped(out io.Writer, stop Stop) {
+	if stop.Message != "" {
+		fmt.Fprintln(out, stop.Message)
+	}
+	if stop.Reason != STOP_HALT {
+		d.where(out)
+	}
+}
+
+/* Prints the source line of the instruction about to run. */
+func (d *Debugger) where(out io.Writer) {
+	line := d.Line()
+	fmt.Fprintf(out, "=> %4d | %s\n", line, d.scanner.Line(line))
+}
+
+/* Lists the source around the current line, marking breakpoints. */
+func (d *Debugger) list(out io.Writer, context int) {
+	current := d.Line()
+	marked := map[int]bool{}
+	for _, line := range d.Breakpoints() {
+		marked[line] = true
+	}
+	for line := current - context; line <= current + context; line += 1 {
+		if line < 1 || line > d.scanner.line {
+			continue
+		}
+		prefix := "  "
+		if line == current {
+			prefix = "=>"
+		}
+		mark := " "
+		if marked[line] {
+			mark = "*"
+		}
+		fmt.Fprintf(out, "%s%s%4d | %s\n", prefix, mark, line, d.scanner.Line(line))
+	}
+}
+
+/* Disassembles the instruction about to run. */
+func (d *Debugger) disassemble(out io.Writer) {
+	DisassembleInstruction(out, d.chunk, d.current())
+}
+
+/* Lists breakpoints, watches and conditions. */
+func (d *Debugger) info(out io.Writer) {
+	fmt.Fprintf(out, "Breakpoints: %v\n", d.Breakpoints())
+	fmt.Fprintf(out, "Watches    : %v\n", d.Watches())
+	for i, text := range d.Conditions() {
+		fmt.Fprintf(out, "Condition %d: %s\n", i + 1, text)
+	}
+}
+
+/* Prints part of the state of the program, or all of it. */
+func (d *Debugger) print(out io.Writer, args []string) error {
+	what := "all"
+	if len(args) > 0 {
+		what = args[0]
+	}
+	switch what {
+	case "all":
+		fmt.Fprintf(out, "Steps : %d\n", d.Steps())
+		fmt.Fprintf(out, "Hand  : %s\n", valueText(d.Hand()))
+		fmt.Fprintf(out, "Inbox : %s\n", valuesText(d.Inbox(), 20))
+		fmt.Fprintf(out, "Outbox: %s\n", valuesText(d.Outbox(), 20))
+		d.printFloor(out)
+	case "hand":
+		fmt.Fprintln(out, valueText(d.Hand()))
+	case "inbox":
+		fmt.Fprintln(out, valuesText(d.Inbox(), -1))
+	case "outbox":
+		fmt.Fprintln(out, valuesText(d.Outbox(), -1))
+	case "floor":
+		d.printFloor(out)
+	default:
+		tile, err := d.Tile(what)
+		if err != nil || tile < 0 || tile >= len(d.Floor()) {
+			return fmt.Errorf("Expected hand, inbox, outbox, floor or a tile, not '%s'.", what)
+		}
+		fmt.Fprintln(out, valueText(d.Floor()[tile]))
+	}
+	return nil
+}
+
+/* Prints the floor, five tiles to a row. */
+func (d *Debugger) printFloor(out io.Writer) {
+	floor := d.Floor()
+	if len(floor) == 0 {
+		fmt.Fprintln(out, "Floor : (no tiles)")
+		return
+	}
+	fmt.Fprintln(out, "Floor :")
+	for i, v := range floor {
+		fmt.Fprintf(out, "  %3d: %-5s", i, valueText(v))
+		if i % 5 == 4 || i == len(floor) - 1 {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+/* Formats a list of values, showing at most limit of them unless limit
+is negative. */
+func valuesText(values []Value, limit int) string {
+	texts := make([]string, 0, len(values))
+	for i, v := range values {
+		if limit >= 0 && i == limit {
+			texts = append(texts, fmt.Sprintf("... (%d more)", len(values) - limit))
+			break
+		}
+		texts = append(texts, valueText(v))
+	}
+	return fmt.Sprintf("[%d] %s", len(values), strings.Join(texts, " "))
+}
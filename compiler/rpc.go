@@ -0,0 +1,45 @@
+package hrm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/* Reads a message framed by a Content-Length header, as sent by clients
+of the Debug Adapter Protocol and the Language Server Protocol. */
+func readMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:")))
+			if err != nil {
+				return nil, fmt.Errorf("Bad Content-Length header '%s'.", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("Message has no Content-Length header.")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+/* Writes a message framed by a Content-Length header. */
+func writeMessage(w io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -2,6 +2,7 @@ package hrm
 
 import (
 	"fmt"
+	"strings"
 )
 /* A token represents a single lexeme. */
 type TokenType int
@@ -24,6 +25,9 @@ const (
 	// Operators + Punctuation
 	MINUS
 	COLON
+	LEFT_BRACKET
+	RIGHT_BRACKET
+	EQUAL
 	
 	// Keywords
 	INBOX
@@ -37,8 +41,12 @@ const (
 	SUB
 	BUMPUP
 	BUMPDN
+	COMMENT
+	TILE
 	
 	// Other
+	DEFINE
+	LINE_COMMENT
 	NEWLINE
 	EOF
 	ERROR
@@ -59,7 +67,9 @@ func (s *Scanner) Init(source string) {
 	s.line = 1
 	s.column = 1
 	s.source = source
-	s.char = source[s.current]
+	if len(source) > 0 {
+		s.char = source[s.current]
+	}
 }
 
 /* Scan for the next token in the stream.
@@ -74,25 +84,30 @@ func (s *Scanner) ScanToken() Token {
 	switch s.char {
 	case '-':
 		if s.peek(1) == '-' {
+			// The comment runs to the end of the line, which is left for a NEWLINE token
 			for !(s.char == '\n' || s.char == 0) {
 				s.advance()
 			}
-			s.advance()
-			s.line += 1
-			s.column = 1
-			return s.ScanToken()
+			token.Type = LINE_COMMENT
+			token.Literal = strings.TrimRight(s.source[s.start:s.current], "\r")
+			return token
 		} else {
-			s.column += 1
 			token.Type = MINUS
 			token.Literal = "-"
 		}
 	case ':':
-		s.column += 1
 		token.Type = COLON
 		token.Literal = ":"
+	case '[':
+		token.Type = LEFT_BRACKET
+		token.Literal = "["
+	case ']':
+		token.Type = RIGHT_BRACKET
+		token.Literal = "]"
+	case '=':
+		token.Type = EQUAL
+		token.Literal = "="
 	case '\n':
-		s.line += 1
-		s.column = 1
 		token.Type = NEWLINE
 		token.Literal = "NEWLINE"
 	case 0:
@@ -105,7 +120,6 @@ func (s *Scanner) ScanToken() Token {
 		case isAlpha(s.char):
 			return s.scanIdentifier(token)
 		default:
-			s.column += 1
 			token.Literal = fmt.Sprintf("Unexpected character '%s'.", string(s.char))
 			token.Type = ERROR
 		}
@@ -114,10 +128,25 @@ func (s *Scanner) ScanToken() Token {
 	return token
 }
 
-/* Advances the scanner to the next character. */
+/* Returns the text of a line in the source, without its line ending. */
+func (s *Scanner) Line(n int) string {
+	lines := strings.Split(s.source, "\n")
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[n - 1], "\r")
+}
+
+/* Advances the scanner to the next character, keeping track of
+the line and column of the new character. */
 func (s *Scanner) advance() {
+	if s.char == '\n' {
+		s.line += 1
+		s.column = 1
+	} else {
+		s.column += 1
+	}
 	s.current += 1
-	s.column += 1
 	if s.current >= len(s.source) {
 		s.char = 0
 		return
@@ -127,13 +156,15 @@ func (s *Scanner) advance() {
 
 /* Peeks n characters ahead. */
 func (s *Scanner) peek(n int) byte {
+	if s.current + n >= len(s.source) {
+		return 0
+	}
 	return s.source[s.current + n]
 }
 
 /* Advances the scanner, skipping all whitespace encountered. */
 func (s *Scanner) skipWhitespace() {
 	for isWhitespace(s.char) {
-		s.column += 1
 		s.advance()
 	}
 }
@@ -142,7 +173,6 @@ func (s *Scanner) skipWhitespace() {
 func (s *Scanner) scanInteger(t Token) Token {
 	literal := ""
 	for isDigit(s.char) {
-		s.column += 1
 		literal += string(s.char)
 		s.advance()
 	}
@@ -155,31 +185,20 @@ func (s *Scanner) scanInteger(t Token) Token {
 func (s *Scanner) scanIdentifier(t Token) Token {
 	literal := ""
 	for isIdentifier(s.char) {
-		s.column += 1
 		literal += string(s.char)
 		s.advance()
 	}
 	if literal == "DEFINE" {
+		// The whole block, up to and including the ';', is a single token
 		for !(s.char == ';' || s.char == 0) {
-				if s.char == '\n' {
-					s.line += 1
-					s.column = 1
-				}
-				s.advance()
-			}
-		s.advance()
-		s.line += 1
-		s.column = 1
-		return s.ScanToken()
-	}
-	if literal == "COMMENT" {
-		for !(s.char == '\n' || s.char == 0) {
 			s.advance()
 		}
-		s.advance()
-		s.line += 1
-		s.column = 1
-		return s.ScanToken()
+		if s.char == ';' {
+			s.advance()
+		}
+		t.Type = DEFINE
+		t.Literal = s.source[s.start:s.current]
+		return t
 	}
 	t.Literal = literal
 	t.Type = s.matchKeyword()
@@ -198,6 +217,8 @@ func (s *Scanner) matchKeyword() TokenType {
 		return BUMPUP
 	case "BUMPDN":
 		return BUMPDN
+	case "COMMENT":
+		return COMMENT
 	case "COPYFROM":
 		return COPYFROM
 	case "COPYTO":
@@ -214,6 +235,8 @@ func (s *Scanner) matchKeyword() TokenType {
 		return OUTBOX
 	case "SUB":
 		return SUB
+	case "TILE":
+		return TILE
 	}
 	return LABEL
 }
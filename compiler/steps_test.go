@@ -0,0 +1,126 @@
+package hrm
+
+import (
+	"testing"
+)
+
+/* A step count records the number of steps the game reports for a
+solution run against a given inbox. The floor is taken from the level.
+Where a solution meets both challenges of its level, the step count is
+the level's speed challenge. */
+type stepCount struct {
+	level int
+	inbox []Value
+	source string
+	steps int
+}
+
+/* Known step counts, as charged by the game. */
+var STEP_COUNTS = []stepCount{
+	{
+		level: 1,
+		inbox: []Value{IntVal(3), CharVal('E'), IntVal(7)},
+		source: `
+    INBOX
+    OUTBOX
+    INBOX
+    OUTBOX
+    INBOX
+    OUTBOX
+`,
+		steps: 6,
+	},
+	{
+		level: 4,
+		inbox: stringValues("BAFEDC"),
+		source: `
+a:
+    INBOX
+    COPYTO 0
+    INBOX
+    OUTBOX
+    COPYFROM 0
+    OUTBOX
+    JUMP a
+`,
+		steps: 21,
+	},
+	{
+		level: 6,
+		inbox: []Value{IntVal(2), IntVal(3), IntVal(-4), IntVal(9), IntVal(0), IntVal(0), IntVal(-7), IntVal(5)},
+		source: `
+a:
+    INBOX
+    COPYTO 0
+    INBOX
+    ADD 0
+    OUTBOX
+    JUMP a
+`,
+		steps: 24,
+	},
+	{
+		// Not-taken JUMPZ instructions are charged
+		level: 7,
+		inbox: []Value{IntVal(0), IntVal(8), IntVal(0), CharVal('A'), IntVal(0), IntVal(0), IntVal(-3), IntVal(0)},
+		source: `
+    JUMP b
+a:
+    OUTBOX
+b:
+    INBOX
+    JUMPZ b
+    JUMP a
+`,
+		steps: 23,
+	},
+	{
+		level: 10,
+		inbox: []Value{IntVal(3), IntVal(-8), IntVal(0), IntVal(5)},
+		source: `
+a:
+    INBOX
+    COPYTO 0
+    ADD 0
+    COPYTO 0
+    ADD 0
+    COPYTO 0
+    ADD 0
+    OUTBOX
+    JUMP a
+`,
+		steps: 36,
+	},
+	{
+		level: 29,
+		inbox: []Value{IntVal(2), IntVal(0), IntVal(9), IntVal(4), IntVal(4)},
+		source: `
+a:
+    INBOX
+    COPYTO 12
+    COPYFROM [12]
+    OUTBOX
+    JUMP a
+`,
+		steps: 25,
+	},
+}
+
+func TestStepCounts(t *testing.T) {
+	for i, test := range STEP_COUNTS {
+		floor, err := LevelFloor(test.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := compileTest(t, test.source)
+		result, err := execute(program, test.inbox, floor, TestConfig{StepMode: STEPS_GAME})
+		if err != nil {
+			t.Errorf("Step count %d (level %d): %v", i + 1, test.level, err)
+			continue
+		}
+		if result.Steps != test.steps {
+			t.Errorf("Step count %d (level %d): expected %d steps, counted %d.",
+				i + 1, test.level, test.steps, result.Steps)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package hrm
 import (
-	"fmt"
-	"os"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
 )
 
 /* Returns a slice of integers [start..stop] by step. */
@@ -22,6 +24,90 @@ func RuneSlice(start, stop rune) []Value {
 	return result
 }
 
+/* Returns a slice of letters spelling out a word. */
+func stringValues(word string) []Value {
+	result := make([]Value, 0, len(word))
+	for _, c := range word {
+		result = append(result, CharVal(c))
+	}
+	return result
+}
+
+/* Returns the values which are not the number zero. */
+func nonZero(values []Value) []Value {
+	result := make([]Value, 0, len(values))
+	for _, x := range values {
+		if x.Type != VAL_INT || x.Int != 0 {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+/* Splits an inbox into the strings ending with each zero, without the
+zeros. Values after the last zero are dropped. */
+func splitStrings(inbox []Value) [][]Value {
+	strings := make([][]Value, 0)
+	start := 0
+	for i, x := range inbox {
+		if x.Type == VAL_INT && x.Int == 0 {
+			strings = append(strings, inbox[start:i])
+			start = i + 1
+		}
+	}
+	return strings
+}
+
+/* Joins strings of values into a single inbox, ending each with a zero. */
+func zeroTerminated(strings ...[]Value) []Value {
+	result := make([]Value, 0)
+	for _, s := range strings {
+		result = append(result, s...)
+		result = append(result, IntVal(0))
+	}
+	return result
+}
+
+/* Checks if a slice of values contains the given value. */
+func containsValue(values []Value, value Value) bool {
+	for _, x := range values {
+		if x == value {
+			return true
+		}
+	}
+	return false
+}
+
+/* Compares two values in the order used by the game: numbers come
+before letters, and letters are ordered alphabetically. */
+func compareValues(a, b Value) int {
+	if a.Type != b.Type {
+		return int(a.Type) - int(b.Type)
+	}
+	if a.Type == VAL_CHAR {
+		return int(a.Char) - int(b.Char)
+	}
+	return a.Int - b.Int
+}
+
+/* Compares two strings of values alphabetically. A string which is
+a prefix of the other comes first. */
+func compareStrings(a, b []Value) int {
+	for i := 0; i < len(a) && i < len(b); i += 1 {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+/* Sorts a slice of values in place, smallest first. */
+func sortValues(values []Value) {
+	sort.Slice(values, func(i, j int) bool {
+		return compareValues(values[i], values[j]) < 0
+	})
+}
+
 // Built-in test inputs
 var POSITIVE_INTEGERS = IntegerSlice(0, 10, 1)
 var ALL_INTEGERS = IntegerSlice(-10, 10, 1)
@@ -29,6 +115,14 @@ var LARGE_INTEGERS = IntegerSlice(-99, 99, 1)
 var ALPHABET = RuneSlice('a', 'z')
 var ALPHANUMERIC = append(ALL_INTEGERS, ALPHABET...)
 
+// Value ranges used by the game's own inboxes
+var GAME_INTEGERS = IntegerSlice(-9, 9, 1)
+var GAME_DIGITS = IntegerSlice(0, 9, 1)
+var GAME_LETTERS = RuneSlice('A', 'Z')
+var GAME_ALPHANUMERIC = append(append([]Value{}, GAME_INTEGERS...), GAME_LETTERS...)
+// Zero-detection levels weight their inboxes towards zeros
+var GAME_ZEROS = []Value{IntVal(0), IntVal(0), IntVal(0), IntVal(0), IntVal(0)}
+
 /* Allocates the registers with a set amount of empty values. */
 func allocateRegisters(n int, registers *[]Value) {
 	for i := 0; i < n; i += 1 {
@@ -36,56 +130,218 @@ func allocateRegisters(n int, registers *[]Value) {
 	}
 }
 
-/* Generates the cartesian product of an iterable with n repeats. */
-func product(n int, iterable []Value) [][]Value {
-	indices := make([]int, n)
-	var result [][]Value
-	for indices != nil {
-		p := make([]Value, n)
-		for i, x := range indices {
-			p[i] = iterable[x]
+/* Inputs generate the inboxes of test cases on demand, passing each to
+yield in turn until there are no more or yield returns false. */
+type inputs func(yield func([]Value) bool)
+
+/* Generates the cartesian product of an iterable with n repeats, one
+tuple at a time, so that the product is never held in memory. */
+func product(n int, iterable []Value) inputs {
+	return func(yield func([]Value) bool) {
+		if len(iterable) == 0 {
+			return
 		}
-		for i := len(indices) - 1; i >= 0; i -= 1 {
-			indices[i] += 1
-			if indices[i] < len(iterable) {
-				break
+		indices := make([]int, n)
+		for {
+			p := make([]Value, n)
+			for i, x := range indices {
+				p[i] = iterable[x]
+			}
+			if !yield(p) {
+				return
+			}
+			i := len(indices) - 1
+			for ; i >= 0; i -= 1 {
+				indices[i] += 1
+				if indices[i] < len(iterable) {
+					break
+				}
+				indices[i] = 0
 			}
-			indices[i] = 0
-			if i <= 0 {
-				indices = nil
-				break
+			if i < 0 {
+				return
 			}
 		}
-		result = append(result, p)
 	}
-	return result
 }
 
-/* Generates a read-only channel which has the inputs
-for running the VM and testing levels. Additionally sends
-values to inbox channel. */
-func generateInputs(n int, data ...[]Value) []Value {
+/* Generates the inputs for running the VM and testing levels: each tuple
+of n values drawn from the given collections. */
+func generateInputs(n int, data ...[]Value) inputs {
 	entries := make([]Value, 0)
 	for _, collection := range data {
-		for _, item := range collection {
-			entries = append(entries, item)
+		entries = append(entries, collection...)
+	}
+	return product(n, entries)
+}
+
+/* Generates each of the given inboxes in turn. */
+func each(inboxes ...[]Value) inputs {
+	return func(yield func([]Value) bool) {
+		for _, inbox := range inboxes {
+			if !yield(inbox) {
+				return
+			}
+		}
+	}
+}
+
+/* Generates consecutive runs of size values, the last of which may be
+shorter. */
+func chunks(values []Value, size int) inputs {
+	return func(yield func([]Value) bool) {
+		for i := 0; i < len(values); i += size {
+			end := i + size
+			if end > len(values) {
+				end = len(values)
+			}
+			if !yield(values[i:end]) {
+				return
+			}
 		}
 	}
-	inputs := make([]Value, 0)
-	for _, xs := range product(n, entries) {
-		for _, x := range xs {
-			inputs = append(inputs, x)
+}
+
+/* Generates the inputs of each source in turn. */
+func chain(sources ...inputs) inputs {
+	return func(yield func([]Value) bool) {
+		stopped := false
+		for _, source := range sources {
+			source(func(inbox []Value) bool {
+				stopped = !yield(inbox)
+				return !stopped
+			})
+			if stopped {
+				return
+			}
 		}
 	}
+}
+
+/* Returns count values chosen at random from the given collections. */
+func randomInputs(rng *rand.Rand, count int, data ...[]Value) []Value {
+	entries := make([]Value, 0)
+	for _, collection := range data {
+		entries = append(entries, collection...)
+	}
+	inputs := make([]Value, count)
+	for i := 0; i < count; i += 1 {
+		inputs[i] = entries[rng.Intn(len(entries))]
+	}
 	return inputs
 }
 
+/* Returns count random strings, each with a length in [min, max]. */
+func randomStrings(rng *rand.Rand, count, min, max int, data ...[]Value) [][]Value {
+	strings := make([][]Value, count)
+	for i := 0; i < count; i += 1 {
+		strings[i] = randomInputs(rng, min + rng.Intn(max - min + 1), data...)
+	}
+	return strings
+}
+
+/* Returns count random pairs, where the first of each pair is drawn from
+first and the second is drawn from second. */
+func randomPairs(rng *rand.Rand, count int, first, second []Value) []Value {
+	inputs := make([]Value, 0, 2 * count)
+	for i := 0; i < count; i += 1 {
+		a := first[rng.Intn(len(first))]
+		b := second[rng.Intn(len(second))]
+		inputs = append(inputs, a, b)
+	}
+	return inputs
+}
+
+/* Generates every pair of values where the first of each pair is drawn
+from first and the second is drawn from second. */
+func allPairs(first, second []Value) inputs {
+	return func(yield func([]Value) bool) {
+		for _, a := range first {
+			for _, b := range second {
+				if !yield([]Value{a, b}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+/* A test case is an inbox for a level, and the outbox expected from it.
+Cases are independent of each other, so each is run with a fresh copy of
+the level's floor. */
+type testCase struct {
+	inbox []Value
+	expected []Value
+}
+
+/* The data a level is tested with. Levels set up their floor in registers
+before adding cases, as a case may be checked as soon as it is added. */
 type data struct {
-	inbox *[]Value
-	expected *[]Value
+	cases func(testCase) bool
 	registers *[]Value
 	goal *INFO
+	rng *rand.Rand
+}
+
+/* Checks if the level should generate a random, game-like inbox
+rather than the exhaustive set of test inputs. */
+func (d data) random() bool {
+	return d.rng != nil
+}
+
+/* Adds a test case to the level. Returns false once no more cases are
+wanted, as checking has stopped. */
+func (d data) add(inbox []Value, expected []Value) bool {
+	return d.cases(testCase{inbox, expected})
+}
+
+/* Adds the test cases of inputs, n inputs to a case, making each case
+from its group of inputs. A case holds a sequence of inputs like the
+game's inbox, so that a program must handle each input after the last.
+Random inputs are all a single case, like a run of the game. Inputs are
+grouped as they are generated, so exhaustive inputs are never all held in
+memory. */
+func (d data) addGroups(in inputs, n int, makeCase func([][]Value) testCase) {
+	group := make([][]Value, 0, n)
+	stopped := false
+	in(func(inbox []Value) bool {
+		group = append(group, inbox)
+		if d.random() || len(group) < n {
+			return true
+		}
+		stopped = !d.cases(makeCase(group))
+		group = make([][]Value, 0, n)
+		return !stopped
+	})
+	if len(group) > 0 && !stopped {
+		d.cases(makeCase(group))
+	}
+}
+
+/* Adds the test cases of inputs, n inputs to a case, taking the expected
+outbox of each case from solve. */
+func (d data) addInputs(in inputs, n int, solve func([]Value) []Value) {
+	d.addGroups(in, n, func(group [][]Value) testCase {
+		inbox := make([]Value, 0)
+		for _, x := range group {
+			inbox = append(inbox, x...)
+		}
+		return testCase{inbox, solve(inbox)}
+	})
 }
+
+/* Adds the test cases of strings, n strings to a case, each ending with
+a zero. The expected outbox of each string is taken from solve. */
+func (d data) addStrings(in inputs, n int, solve func([]Value) []Value) {
+	d.addGroups(in, n, func(group [][]Value) testCase {
+		expected := make([]Value, 0)
+		for _, s := range group {
+			expected = append(expected, solve(s)...)
+		}
+		return testCase{zeroTerminated(group...), expected}
+	})
+}
+
 type levelFn func(data)
 var Level map[int]levelFn = map[int]levelFn{
 	1: Level1,
@@ -126,46 +382,32 @@ var Level map[int]levelFn = map[int]levelFn{
 	41: Level41,
 }
 
-func TestLevel(level int, source string, debug bool) bool {
-	// Simulate each level in Go
-	inbox := make([]Value, 0)
-	outbox := make([]Value, 0)
-	expected := make([]Value, 0)
-	registers := make([]Value, 0)
-	goal := INFO{}
-	data := data{&inbox, &expected, &registers, &goal}
-	if test, ok := Level[level]; ok {
-		test(data)
-	} else {
-		fmt.Printf("No test written for level %d.\n", level)
-		os.Exit(2)
-	}
-	var vm VM
-	vm.Init(debug, inbox, &outbox, registers)
-	state, info := vm.Interpret(source)
-	if state != INTERPRET_OK {
-		return false
-	}
-	fmt.Printf("Steps: %-4d Size: %-4d\n", info.steps, info.size)
-	// Assert that all outbox values are expected
-	if len(expected) < len(outbox) {
-		fmt.Printf("Too many values in OUTBOX.\n")
-		return false
-	}
-	if len(expected) > len(outbox) {
-		fmt.Printf("Not enough stuff in the OUTBOX! " +
-		"Management expected a total of %d items, not %d!\n",
-		len(expected), len(outbox))
-		return false
-	}
-	fmt.Printf("Expecting INBOX (%d values) -> OUTBOX (%d values)...\n", len(inbox), len(expected))
-	for i, expVal := range expected {
-		if outVal := outbox[i]; expVal != outVal {
-			fmt.Printf("Bad outbox! Management expected %v, " +
-			"but you outboxed %v.\n", expVal, outVal)
-			return false
-		}
+/* Options for testing a level. When Runs is zero, the level is tested
+once against its exhaustive inputs. Otherwise, Runs independent random
+inboxes are generated from Seed, each with a freshly reset floor.
+StepMode selects how steps are counted, and Backend how the program is
+run. Executed instructions are traced to Debug unless it is nil, which
+only the VM backend does. Test cases are checked by Workers goroutines,
+or one per CPU if it is zero, and checking stops at the first failure
+unless AllFailures is set. */
+type TestConfig struct {
+	Debug io.Writer
+	Runs int
+	Seed int64
+	StepMode StepMode
+	Backend Backend
+	Workers int
+	AllFailures bool
+}
+
+/* Returns the number of goroutines to check test cases on. Traced cases
+are checked one at a time, so that their traces do not interleave. */
+func (config TestConfig) workers() int {
+	switch {
+	case config.Debug != nil:
+		return 1
+	case config.Workers > 0:
+		return config.Workers
 	}
-	fmt.Printf("Level %d test passed.", level)
-	return true
+	return runtime.GOMAXPROCS(0)
 }
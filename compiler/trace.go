@@ -0,0 +1,148 @@
+package hrm
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+/* A trace event records one executed instruction, as a line of JSON.
+Values are numbers or letters, and an empty hand is null. Reads lists
+the tiles read, including the address tile of an indirect operand. Inbox
+and Outbox hold the value taken from the inbox or sent to the outbox. */
+type TraceEvent struct {
+	Step int `json:"step"`
+	Steps int `json:"steps"`
+	IP int `json:"ip"`
+	Line int `json:"line"`
+	Op string `json:"op"`
+	Operand string `json:"operand,omitempty"`
+	HandBefore interface{} `json:"hand_before"`
+	HandAfter interface{} `json:"hand_after"`
+	Reads []TileRead `json:"reads,omitempty"`
+	Writes []TileWrite `json:"writes,omitempty"`
+	Inbox interface{} `json:"inbox,omitempty"`
+	Outbox interface{} `json:"outbox,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+/* A tile read by an instruction, and the value it held. */
+type TileRead struct {
+	Tile int `json:"tile"`
+	Value interface{} `json:"value"`
+}
+
+/* A tile written by an instruction, with its values before and after. */
+type TileWrite struct {
+	Tile int `json:"tile"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+/* Runs the program to the end, writing a trace event for each
+instruction to w as JSON Lines. Breakpoints, watches and conditions are
+ignored. Instructions are named as the disassembly names them. The
+history is not recorded, as a trace is never run backwards, so the program
+cannot be reversed past the end of the trace. Returns why the program
+stopped, and any error writing the trace. */
+func (d *Debugger) Trace(w io.Writer) (Stop, error) {
+	encoder := json.NewEncoder(w)
+	names := d.labelNames()
+	d.recording = false
+	defer func() {
+		d.recording = true
+	}()
+	for step := 1; !d.halted; step += 1 {
+		in := d.instructions[d.current()]
+		if in.op == OP_HALT {
+			d.instruction()
+			break
+		}
+		event := TraceEvent{
+			Step: step,
+			IP: d.current(),
+			Line: in.line,
+			Op: mnemonic(in.op),
+			HandBefore: valueJSON(d.vm.hand),
+		}
+		switch {
+		case in.target >= 0:
+			event.Operand = names[in.target]
+		case in.tile >= 0:
+			event.Operand = tileOperand(in)
+		}
+		event.Reads = d.reads(in)
+		inbox, outbox := len(d.vm.inbox), len(d.outbox)
+		tile := d.writes(in)
+		var old Value
+		if tile >= 0 {
+			old = d.vm.registers[tile]
+		}
+		d.instruction()
+		event.Steps = d.vm.steps
+		event.HandAfter = valueJSON(d.vm.hand)
+		if tile >= 0 && d.state != INTERPRET_RUNTIME_ERROR {
+			event.Writes = []TileWrite{{tile, valueJSON(old), valueJSON(d.vm.registers[tile])}}
+		}
+		if len(d.vm.inbox) < inbox {
+			event.Inbox = valueJSON(d.inbox[len(d.inbox) - inbox])
+		}
+		if len(d.outbox) > outbox {
+			event.Outbox = valueJSON(d.outbox[outbox])
+		}
+		if d.vm.err != nil {
+			event.Error = d.vm.err.Message
+		}
+		if err := encoder.Encode(event); err != nil {
+			return Stop{}, err
+		}
+	}
+	return d.finished(), nil
+}
+
+/* Returns the tiles an instruction is about to read, with their values.
+Tiles which cannot be read are left out, as the instruction will fail. */
+func (d *Debugger) reads(in instruction) []TileRead {
+	registers := d.vm.registers
+	reads := make([]TileRead, 0, 2)
+	if in.indirect && in.tile < len(registers) {
+		reads = append(reads, TileRead{in.tile, valueJSON(registers[in.tile])})
+	}
+	switch in.op {
+	case OP_COPYFROM, OP_ADD, OP_SUB, OP_BUMPUP, OP_BUMPDN:
+		if tile := d.address(in); tile >= 0 {
+			reads = append(reads, TileRead{tile, valueJSON(registers[tile])})
+		}
+	}
+	return reads
+}
+
+/* Returns the name of the label at each instruction. Where several
+labels share an instruction, the first in alphabetical order is used. */
+func (d *Debugger) labelNames() map[int]string {
+	labels := make([]string, 0, len(d.labels))
+	for label := range d.labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	names := map[int]string{}
+	for _, label := range labels {
+		if _, ok := names[d.labels[label]]; !ok {
+			names[d.labels[label]] = label
+		}
+	}
+	return names
+}
+
+/* Converts a value for JSON: a number, a letter, or null if empty. */
+func valueJSON(v Value) interface{} {
+	switch v.Type {
+	case VAL_INT:
+		return v.Int
+	case VAL_CHAR:
+		return string(v.Char)
+	case VAL_EMPTY:
+		return nil
+	}
+	return v.String()
+}
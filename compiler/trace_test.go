@@ -0,0 +1,41 @@
+package hrm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	source := "    INBOX\n    COPYTO 0\n    BUMPUP 0\n    ADD [1]\n    OUTBOX\n"
+	d, diagnostics := NewDebugger(source, Inbox{IntVal(5)}, Floor{EmptyVal(), IntVal(0)}, nil)
+	if len(diagnostics) > 0 {
+		t.Fatal(compileError(diagnostics))
+	}
+	var b bytes.Buffer
+	stop, err := d.Trace(&b)
+	if err != nil || stop.Reason != STOP_HALT {
+		t.Fatalf("Expected the program to finish, got %+v, %v.", stop, err)
+	}
+	expected := []string{
+		`{"step":1,"steps":1,"ip":0,"line":1,"op":"INBOX","hand_before":null,"hand_after":5,"inbox":5}`,
+		`{"step":2,"steps":2,"ip":1,"line":2,"op":"COPYTO","operand":"0","hand_before":5,"hand_after":5,"writes":[{"tile":0,"old":null,"new":5}]}`,
+		`{"step":3,"steps":3,"ip":2,"line":3,"op":"BUMP+","operand":"0","hand_before":5,"hand_after":6,"reads":[{"tile":0,"value":5}],"writes":[{"tile":0,"old":5,"new":6}]}`,
+		// The address tile is read before the tile it points to
+		`{"step":4,"steps":4,"ip":3,"line":4,"op":"ADD","operand":"[1]","hand_before":6,"hand_after":12,"reads":[{"tile":1,"value":0},{"tile":0,"value":6}]}`,
+		`{"step":5,"steps":5,"ip":4,"line":5,"op":"OUTBOX","hand_before":12,"hand_after":null,"outbox":12}`,
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d events, got\n%s", len(expected), b.String())
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("Event %d: expected\n%s\ngot\n%s", i + 1, expected[i], line)
+		}
+	}
+	// No history is kept, so there is nothing to reverse
+	if stop := d.ReverseStep(); stop.Reason != STOP_START || len(d.history) != 0 {
+		t.Errorf("Expected no history after a trace, got %+v with %d records.", stop, len(d.history))
+	}
+}
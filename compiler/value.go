@@ -7,46 +7,38 @@ import (
 /* 
 Human Resource Machine (HRM) Instruction Set
 ============================================
-INBOX: Pick up the next thing from the INBOX.
-
-OUTBOX: Put whatever you are holding into the outbox.
-
-COPYFROM: Walk to a specific tile on the floor and pick up a copy of whatever
-is there.
-
-COPYTO: Copy whatever you are currently holding to a specific tile on the floor.
-
-JUMP: Jump to a new location within your program. You can jump backward to
-create loops, or jump forward to skip entire sections. The possibilities
-are endless!
-
-JUMP IF ZERO: Jump only if you are currently holding a ZERO. Otherwise continue
-to the next line in your program.
-
-JUMP IF NEGATIVE: Jump only if you are currently holding a negative number. Otherwise
-continue to the next line in your program.
-
-ADD: Add the contents of a specific tile to whatever you are currently holding.
-The result goes back into your hands.
-
-SUB: Subtract the contents of a specific tile on the floor FROM whatever you
-are currently holding. The result goes back into your hands.
-
-BUMP+: Add ONE to the contents of a specific tile on the floor. The result is
-written back to the floor, and also back into your hands for your convenience!
-
-BUMP-: Subtract ONE to the contents of a specific tile on the floor. The result is
-written back to the floor, and also back into your hands for your convenience!
-
-COMMENT: Use comments to leave helpful notes for yourself within your program.
-Does not affect your program in any way, other than making it easier for you
-to read!
+The game's own description of each instruction, keyed by its mnemonic.
+Any instruction which uses a tile on the floor may instead use [n], which
+refers to the tile whose address is the value stored on tile n.
 */
+var INSTRUCTION_DOCS = map[string]string{
+	"INBOX": "Pick up the next thing from the INBOX.",
+	"OUTBOX": "Put whatever you are holding into the outbox.",
+	"COPYFROM": "Walk to a specific tile on the floor and pick up a copy of whatever\n" +
+		"is there.",
+	"COPYTO": "Copy whatever you are currently holding to a specific tile on the floor.",
+	"JUMP": "Jump to a new location within your program. You can jump backward to\n" +
+		"create loops, or jump forward to skip entire sections. The possibilities\n" +
+		"are endless!",
+	"JUMPZ": "JUMP IF ZERO: Jump only if you are currently holding a ZERO. Otherwise continue\n" +
+		"to the next line in your program.",
+	"JUMPN": "JUMP IF NEGATIVE: Jump only if you are currently holding a negative number. Otherwise\n" +
+		"continue to the next line in your program.",
+	"ADD": "Add the contents of a specific tile to whatever you are currently holding.\n" +
+		"The result goes back into your hands.",
+	"SUB": "Subtract the contents of a specific tile on the floor FROM whatever you\n" +
+		"are currently holding. The result goes back into your hands.",
+	"BUMPUP": "BUMP+: Add ONE to the contents of a specific tile on the floor. The result is\n" +
+		"written back to the floor, and also back into your hands for your convenience!",
+	"BUMPDN": "BUMP-: Subtract ONE to the contents of a specific tile on the floor. The result is\n" +
+		"written back to the floor, and also back into your hands for your convenience!",
+	"COMMENT": "Use comments to leave helpful notes for yourself within your program.\n" +
+		"Does not affect your program in any way, other than making it easier for you\n" +
+		"to read!",
+}
 
 const (
 	OP_HALT byte = iota
-	OP_POP
-	OP_CONSTANT
 	OP_INBOX
 	OP_OUTBOX
 	OP_JUMP
@@ -58,7 +50,6 @@ const (
 	OP_SUB
 	OP_BUMPUP
 	OP_BUMPDN
-	OP_NEGATE
 )
 
 type ValueType int
@@ -106,3 +97,54 @@ func IntVal(i int) Value {
 func LabelVal(l string) Value {
 	return Value{Type: VAL_LABEL, Label: l}
 }
+
+/* Values are restricted to the range of numbers the game can display. */
+const (
+	MIN_VALUE = -999
+	MAX_VALUE = 999
+)
+
+const (
+	OVERFLOW_ERROR = "Overflow! Each data unit is restricted to values between " +
+		"-999 and 999. That should be enough for anybody."
+	LETTER_ERROR = "You can't %s with a letter! What would that even mean?!"
+)
+
+/* Checks that a number is inside the range of values the game allows. */
+func checkRange(i int) (Value, error) {
+	if i < MIN_VALUE || i > MAX_VALUE {
+		return Value{}, &RuntimeError{Kind: ERR_OVERFLOW, Message: OVERFLOW_ERROR}
+	}
+	return IntVal(i), nil
+}
+
+/* Adds another value to this value. Only numbers can be added. */
+func (v Value) Add(w Value) (Value, error) {
+	if v.Type != VAL_INT || w.Type != VAL_INT {
+		return Value{}, &RuntimeError{Kind: ERR_LETTER, Message: fmt.Sprintf(LETTER_ERROR, "ADD")}
+	}
+	return checkRange(v.Int + w.Int)
+}
+
+/* Subtracts another value from this value. Numbers subtract as usual,
+while subtracting two letters gives their distance in the alphabet. A
+letter and a number cannot be subtracted. */
+func (v Value) Sub(w Value) (Value, error) {
+	switch {
+	case v.Type == VAL_INT && w.Type == VAL_INT:
+		return checkRange(v.Int - w.Int)
+	case v.Type == VAL_CHAR && w.Type == VAL_CHAR:
+		// Letters are A to Z, so their distance is at most 25 either way
+		// and needs no range check
+		return IntVal(int(v.Char - w.Char)), nil
+	}
+	return Value{}, &RuntimeError{Kind: ERR_LETTER, Message: fmt.Sprintf(LETTER_ERROR, "SUB")}
+}
+
+/* Adds n to a number, as done by BUMP+ and BUMP-. */
+func (v Value) Bump(n int, opcode string) (Value, error) {
+	if v.Type != VAL_INT {
+		return Value{}, &RuntimeError{Kind: ERR_LETTER, Message: fmt.Sprintf(LETTER_ERROR, opcode)}
+	}
+	return checkRange(v.Int + n)
+}
@@ -0,0 +1,49 @@
+package hrm
+
+import (
+	"fmt"
+	"testing"
+)
+
+/* Arithmetic on values as the game does it, with the result or the kind
+of error expected. */
+var ARITHMETIC = []struct {
+	name string
+	run func() (Value, error)
+	result Value
+	kind ErrorKind
+	message string
+}{
+	{"C-A", func() (Value, error) { return CharVal('C').Sub(CharVal('A')) }, IntVal(2), 0, ""},
+	{"A-C", func() (Value, error) { return CharVal('A').Sub(CharVal('C')) }, IntVal(-2), 0, ""},
+	{"Z-A", func() (Value, error) { return CharVal('Z').Sub(CharVal('A')) }, IntVal(25), 0, ""},
+	{"7-9", func() (Value, error) { return IntVal(7).Sub(IntVal(9)) }, IntVal(-2), 0, ""},
+	{"A-1", func() (Value, error) { return CharVal('A').Sub(IntVal(1)) }, Value{}, ERR_LETTER, fmt.Sprintf(LETTER_ERROR, "SUB")},
+	{"1-A", func() (Value, error) { return IntVal(1).Sub(CharVal('A')) }, Value{}, ERR_LETTER, fmt.Sprintf(LETTER_ERROR, "SUB")},
+	{"A+B", func() (Value, error) { return CharVal('A').Add(CharVal('B')) }, Value{}, ERR_LETTER, fmt.Sprintf(LETTER_ERROR, "ADD")},
+	{"A+1", func() (Value, error) { return CharVal('A').Add(IntVal(1)) }, Value{}, ERR_LETTER, fmt.Sprintf(LETTER_ERROR, "ADD")},
+	{"BUMPUP A", func() (Value, error) { return CharVal('A').Bump(1, "BUMPUP") }, Value{}, ERR_LETTER, fmt.Sprintf(LETTER_ERROR, "BUMPUP")},
+	{"BUMPDN A", func() (Value, error) { return CharVal('A').Bump(-1, "BUMPDN") }, Value{}, ERR_LETTER, fmt.Sprintf(LETTER_ERROR, "BUMPDN")},
+	{"999+0", func() (Value, error) { return IntVal(999).Add(IntVal(0)) }, IntVal(999), 0, ""},
+	{"999+1", func() (Value, error) { return IntVal(999).Add(IntVal(1)) }, Value{}, ERR_OVERFLOW, OVERFLOW_ERROR},
+	{"-999-1", func() (Value, error) { return IntVal(-999).Sub(IntVal(1)) }, Value{}, ERR_OVERFLOW, OVERFLOW_ERROR},
+	{"BUMPUP 999", func() (Value, error) { return IntVal(999).Bump(1, "BUMPUP") }, Value{}, ERR_OVERFLOW, OVERFLOW_ERROR},
+	{"BUMPDN -999", func() (Value, error) { return IntVal(-999).Bump(-1, "BUMPDN") }, Value{}, ERR_OVERFLOW, OVERFLOW_ERROR},
+	{"BUMPDN -998", func() (Value, error) { return IntVal(-998).Bump(-1, "BUMPDN") }, IntVal(-999), 0, ""},
+}
+
+func TestArithmetic(t *testing.T) {
+	for _, test := range ARITHMETIC {
+		result, err := test.run()
+		if test.message == "" {
+			if err != nil || result != test.result {
+				t.Errorf("%s: expected %v, got %v, %v.", test.name, test.result, result, err)
+			}
+			continue
+		}
+		e, ok := err.(*RuntimeError)
+		if !ok || e.Kind != test.kind || e.Message != test.message {
+			t.Errorf("%s: expected %q, got %v.", test.name, test.message, err)
+		}
+	}
+}
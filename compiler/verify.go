@@ -0,0 +1,66 @@
+package hrm
+
+import (
+	"fmt"
+)
+
+const (
+	BAD_JUMP_ERROR = "Bad jump! There is no instruction %d to jump to."
+	BAD_END_ERROR = "The program runs past the end of its code."
+	BAD_OPERAND_ERROR = "Bad operand! %s needs a tile to use."
+)
+
+/* Checks that a chunk is safe to run on a floor of the given size, so
+that a bad chunk is rejected before it runs rather than partway through:
+- every opcode is known
+- every jump lands on an instruction, and the last instruction does not
+run past the end
+- every instruction using a tile has one, and every tile given directly,
+or holding an address, is on the floor
+Instructions are decoded rather than encoded as bytes, so there is no
+operand stack to keep balanced. Returns nil if the chunk is safe. */
+func (chunk *Chunk) verify(floor int) *RuntimeError {
+	reject := func(in instruction, kind ErrorKind, tile int, format string, args ...interface{}) *RuntimeError {
+		return &RuntimeError{
+			Line: in.line,
+			Column: in.column,
+			Instruction: instructionName(in.op),
+			Tile: tile,
+			Kind: kind,
+			Message: fmt.Sprintf(format, args...),
+		}
+	}
+	if len(chunk.code) == 0 {
+		return &RuntimeError{Tile: -1, Kind: ERR_BAD_JUMP, Message: BAD_END_ERROR}
+	}
+	last := len(chunk.code) - 1
+	for i, in := range chunk.code {
+		switch in.op {
+		case OP_HALT:
+		case OP_INBOX, OP_OUTBOX:
+			if i == last {
+				return reject(in, ERR_BAD_JUMP, -1, BAD_END_ERROR)
+			}
+		case OP_JUMP, OP_JUMPZ, OP_JUMPN:
+			if in.target < 0 || in.target > last {
+				return reject(in, ERR_BAD_JUMP, -1, BAD_JUMP_ERROR, in.target)
+			}
+			if in.op != OP_JUMP && i == last {
+				return reject(in, ERR_BAD_JUMP, -1, BAD_END_ERROR)
+			}
+		case OP_COPYFROM, OP_COPYTO, OP_ADD, OP_SUB, OP_BUMPUP, OP_BUMPDN:
+			if in.tile < 0 {
+				return reject(in, ERR_BAD_OPERAND, -1, BAD_OPERAND_ERROR, instructionName(in.op))
+			}
+			if in.tile >= floor {
+				return reject(in, ERR_NO_TILE, in.tile, NO_TILE_ERROR, floor)
+			}
+			if i == last {
+				return reject(in, ERR_BAD_JUMP, -1, BAD_END_ERROR)
+			}
+		default:
+			return reject(in, ERR_UNKNOWN_OPCODE, -1, "Unknown opcode %d.", in.op)
+		}
+	}
+	return nil
+}
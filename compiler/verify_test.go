@@ -0,0 +1,80 @@
+package hrm
+
+import (
+	"testing"
+)
+
+/* Chunks which verify must reject, with the error expected of each. */
+var BAD_CHUNKS = []struct {
+	name string
+	code []instruction
+	kind ErrorKind
+	line int
+	tile int
+}{
+	{"Empty", nil, ERR_BAD_JUMP, 0, -1},
+	{"MissingTarget", []instruction{
+		{op: OP_JUMP, tile: -1, target: 5, line: 1},
+	}, ERR_BAD_JUMP, 1, -1},
+	{"NegativeTarget", []instruction{
+		{op: OP_JUMP, tile: -1, target: -1, line: 1},
+	}, ERR_BAD_JUMP, 1, -1},
+	{"PastEnd", []instruction{
+		{op: OP_INBOX, tile: -1, line: 1},
+		{op: OP_OUTBOX, tile: -1, line: 2},
+	}, ERR_BAD_JUMP, 2, -1},
+	{"ConditionalPastEnd", []instruction{
+		{op: OP_INBOX, tile: -1, line: 1},
+		{op: OP_JUMPZ, tile: -1, target: 0, line: 2},
+	}, ERR_BAD_JUMP, 2, -1},
+	{"UnknownOpcode", []instruction{
+		{op: 200, tile: -1, line: 1},
+		{op: OP_HALT, tile: -1},
+	}, ERR_UNKNOWN_OPCODE, 1, -1},
+	{"NegativeTile", []instruction{
+		{op: OP_COPYTO, tile: -1, line: 1},
+		{op: OP_HALT, tile: -1},
+	}, ERR_BAD_OPERAND, 1, -1},
+	{"OffFloor", []instruction{
+		{op: OP_COPYTO, tile: 3, line: 1},
+		{op: OP_HALT, tile: -1},
+	}, ERR_NO_TILE, 1, 3},
+	{"IndirectOffFloor", []instruction{
+		{op: OP_COPYFROM, indirect: true, tile: 20, line: 1},
+		{op: OP_HALT, tile: -1},
+	}, ERR_NO_TILE, 1, 20},
+}
+
+func TestVerifyRejects(t *testing.T) {
+	for _, test := range BAD_CHUNKS {
+		t.Run(test.name, func(t *testing.T) {
+			chunk := Chunk{test.code}
+			err := chunk.verify(3)
+			if err == nil {
+				t.Fatal("Expected the chunk to be rejected.")
+			}
+			if err.Kind != test.kind || err.Line != test.line || err.Tile != test.tile {
+				t.Errorf("Expected %v on line %d at tile %d, got %+v.", test.kind, test.line, test.tile, *err)
+			}
+		})
+	}
+}
+
+/* A compiled program is verified against the floor it runs on before it
+runs, so nothing is taken from the inbox. */
+func TestVerifyFloor(t *testing.T) {
+	program := compileTest(t, "    INBOX\n    COPYTO 20\n    OUTBOX\n")
+	if err := program.chunk.verify(MAX_FLOOR); err != nil {
+		t.Fatalf("Expected tile 20 to be on the largest floor, got %v.", err)
+	}
+	for _, backend := range []Backend{BACKEND_VM, BACKEND_CLOSURE} {
+		result, err := execute(program, Inbox{IntVal(1)}, make(Floor, 3), TestConfig{Backend: backend})
+		e, ok := err.(*RuntimeError)
+		if !ok || e.Kind != ERR_NO_TILE || e.Line != 2 || e.Column != 5 || e.Tile != 20 {
+			t.Errorf("%s: expected tile 20 to be off the floor on line 2, got %v.", backend, err)
+		}
+		if result.Steps != 0 {
+			t.Errorf("%s: expected no steps before the error, got %d.", backend, result.Steps)
+		}
+	}
+}
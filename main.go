@@ -1,31 +1,114 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"math/rand"
 	"strconv"
+	"strings"
+	"time"
 	"hrm/compiler"
 )
 
 func main() {
 	// Enter level number and path to level source code
 	// Optionally include -debug flag (for development/testing)
+	// Use -runs to test against random inboxes like the game does
+	var config hrm.TestConfig
 	var debug bool
 	flag.BoolVar(&debug, "debug", false, "Enable compiler debug mode.")
+	flag.IntVar(&config.Runs, "runs", 0, "Number of random test runs (0 tests all combinations).")
+	flag.Int64Var(&config.Seed, "seed", time.Now().UnixNano(), "Seed for random test runs.")
+	flag.IntVar(&config.Workers, "workers", 0, "Number of goroutines checking test cases (0 uses every CPU).")
+	flag.BoolVar(&config.AllFailures, "all-failures", false, "Check every test case rather than stopping at the first failure.")
+	var backend string
+	flag.StringVar(&backend, "backend", "vm", "Backend to run programs on: vm or closure.")
+	var takenJumps bool
+	flag.BoolVar(&takenJumps, "taken-jumps", false, "Only count conditional jumps as steps when taken.")
 	flag.Parse()
+	var err error
+	if config.Backend, err = hrm.ParseBackend(backend); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if debug {
+		config.Debug = os.Stdout
+	}
+	if takenJumps {
+		config.StepMode = hrm.STEPS_TAKEN_JUMPS
+	}
+	switch flag.Arg(0) {
+	case "lint":
+		lint(flag.Args()[1:])
+		return
+	case "debug":
+		debugLevel(flag.Args()[1:], config)
+		return
+	case "trace":
+		traceLevel(flag.Args()[1:], config)
+		return
+	case "dap":
+		if err := hrm.ServeDAP(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	case "fmt":
+		format(flag.Args()[1:])
+		return
+	case "bench":
+		bench(flag.Args()[1:], config)
+		return
+	case "emit-c":
+		emitC(flag.Args()[1:], config)
+		return
+	case "lsp":
+		if err := hrm.ServeLSP(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	if len(flag.Args()) != 2 {
-		fmt.Printf("Usage: hrm <level> <source path>\n")
+		usage()
+	}
+	level := parseLevel(flag.Arg(0))
+	source := readSource(flag.Arg(1))
+	// Test level by compiling and comparing with expected values
+	if !testLevel(level, source, config) {
 		os.Exit(1)
 	}
-	level, err := strconv.Atoi(flag.Arg(0))
+}
+
+/* Prints how to use the command and exits. */
+func usage() {
+	fmt.Printf("Usage: hrm [-runs n] [-seed n] [-taken-jumps] [-backend vm|closure] [-workers n] [-all-failures] <level> <source path>\n")
+	fmt.Printf("       hrm lint [level] <source path>\n")
+	fmt.Printf("       hrm [-runs n] [-seed n] debug <level> <source path>\n")
+	fmt.Printf("       hrm [-runs n] [-seed n] trace <level> <source path> [--out trace.jsonl]\n")
+	fmt.Printf("       hrm dap\n")
+	fmt.Printf("       hrm lsp\n")
+	fmt.Printf("       hrm fmt <source path> [--write] [--export]\n")
+	fmt.Printf("       hrm [-backend vm|closure] bench <level> <source path> [--time 1s]\n")
+	fmt.Printf("       hrm [-taken-jumps] emit-c [level] <source path>\n")
+	os.Exit(1)
+}
+
+/* Parses a level number, exiting if it is not a number. */
+func parseLevel(arg string) int {
+	level, err := strconv.Atoi(arg)
 	if err != nil {
 		fmt.Printf("Level must be a positive integer.\n")
 		os.Exit(1)
 	}
-	// Handle reading file source
-	path := flag.Arg(1)
+	return level
+}
+
+/* Reads the source code of a program, exiting if it cannot be read. */
+func readSource(path string) string {
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -36,6 +119,304 @@ func main() {
 		fmt.Printf("No data read from '%s'.\n", path)
 		os.Exit(1)
 	}
-	// Test level by compiling and comparing with expected values
-	hrm.TestLevel(level, source, debug)
+	return source
+}
+
+/* Formats a program in the game's clipboard layout, printing it or
+rewriting the file in place. Exporting also replaces named tiles by their
+numbers. Exits with an error status if the program
+does not compile. */
+func format(args []string) {
+	write := false
+	export := false
+	paths := make([]string, 0, 1)
+	for _, arg := range args {
+		switch arg {
+		case "-w", "-write", "--write":
+			write = true
+		case "-export", "--export":
+			export = true
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) != 1 {
+		usage()
+	}
+	formatter := hrm.Format
+	if export {
+		formatter = hrm.Export
+	}
+	formatted, diagnostics := formatter(readSource(paths[0]))
+	if len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			fmt.Println(d.Excerpt())
+		}
+		os.Exit(1)
+	}
+	if !write {
+		fmt.Print(formatted)
+		return
+	}
+	if err := ioutil.WriteFile(paths[0], []byte(formatted), 0644); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+/* Times a program against a level's exhaustive inbox, run over and over
+for the given time on the configured backend, and prints how many steps
+it ran per second. */
+func bench(args []string, config hrm.TestConfig) {
+	duration := time.Second
+	paths := make([]string, 0, 2)
+	for i := 0; i < len(args); i += 1 {
+		switch {
+		case (args[i] == "-time" || args[i] == "--time") && i + 1 < len(args):
+			d, err := time.ParseDuration(args[i + 1])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			duration = d
+			i += 1
+		default:
+			paths = append(paths, args[i])
+		}
+	}
+	if len(paths) != 2 {
+		usage()
+	}
+	level := parseLevel(paths[0])
+	program, diagnostics := hrm.Compile(readSource(paths[1]))
+	for _, d := range diagnostics {
+		fmt.Println(d.Excerpt())
+	}
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+	result, err := hrm.Bench(level, program, duration, config)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(result)
+}
+
+/* Prints a program as a standalone C program, with the floor of the
+level if one is given. */
+func emitC(args []string, config hrm.TestConfig) {
+	var floor hrm.Floor
+	switch len(args) {
+	case 1:
+	case 2:
+		var err error
+		floor, err = hrm.LevelFloor(parseLevel(args[0]))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		args = args[1:]
+	default:
+		usage()
+	}
+	program, diagnostics := hrm.Compile(readSource(args[0]))
+	for _, d := range diagnostics {
+		fmt.Fprintln(os.Stderr, d.Excerpt())
+	}
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+	fmt.Print(hrm.EmitC(program, floor, config.StepMode))
+}
+
+/* Lints a program, using the floor of the level if one is given.
+Exits with an error status if any problems are found. */
+func lint(args []string) {
+	var floor hrm.Floor
+	switch len(args) {
+	case 1:
+	case 2:
+		var err error
+		floor, err = hrm.LevelFloor(parseLevel(args[0]))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		args = args[1:]
+	default:
+		usage()
+	}
+	diagnostics := hrm.Lint(readSource(args[0]), floor)
+	for _, d := range diagnostics {
+		fmt.Println(d.Excerpt())
+	}
+	if len(diagnostics) > 0 {
+		fmt.Printf("%d problem(s) found.\n", len(diagnostics))
+		os.Exit(1)
+	}
+	fmt.Printf("No problems found.\n")
+}
+
+/* Debugs a program interactively against a level. */
+func debugLevel(args []string, config hrm.TestConfig) {
+	if len(args) != 2 {
+		usage()
+	}
+	debugger, inbox := levelDebugger(args[0], args[1], config)
+	fmt.Printf("Debugging level %s against %d inbox values. Type 'help' for commands.\n", args[0], len(inbox))
+	debugger.Repl(os.Stdin, os.Stdout)
+}
+
+/* Traces a program against a level, writing an event for every executed
+instruction as JSON Lines to the file given by --out, or to stdout. */
+func traceLevel(args []string, config hrm.TestConfig) {
+	out := ""
+	paths := make([]string, 0, 2)
+	for i := 0; i < len(args); i += 1 {
+		switch {
+		case (args[i] == "-out" || args[i] == "--out") && i + 1 < len(args):
+			out = args[i + 1]
+			i += 1
+		case strings.HasPrefix(args[i], "--out="):
+			out = strings.TrimPrefix(args[i], "--out=")
+		default:
+			paths = append(paths, args[i])
+		}
+	}
+	if len(paths) != 2 {
+		usage()
+	}
+	debugger, _ := levelDebugger(paths[0], paths[1], config)
+	w := os.Stdout
+	if out != "" {
+		file, err := os.Create(out)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+	buffer := bufio.NewWriter(w)
+	stop, err := debugger.Trace(buffer)
+	if err == nil {
+		err = buffer.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, stop.Message)
+	if stop.Reason == hrm.STOP_ERROR {
+		os.Exit(1)
+	}
+}
+
+/* Compiles a program for debugging against a level. The level's exhaustive
+inbox is used, or a random one if -runs is given. */
+func levelDebugger(level string, path string, config hrm.TestConfig) (*hrm.Debugger, hrm.Inbox) {
+	var rng *rand.Rand
+	if config.Runs > 0 {
+		rng = rand.New(rand.NewSource(config.Seed))
+		fmt.Fprintf(os.Stderr, "Seed: %d\n", config.Seed)
+	}
+	inbox, expected, floor, err := hrm.LevelRun(parseLevel(level), rng)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	debugger, diagnostics := hrm.NewDebugger(readSource(path), inbox, floor, expected)
+	for _, d := range diagnostics {
+		fmt.Println(d.Excerpt())
+	}
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+	return debugger, inbox
+}
+
+/* Compiles and checks a program against a level, printing the results. */
+func testLevel(level int, source string, config hrm.TestConfig) bool {
+	program, diagnostics := hrm.Compile(source)
+	if len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			fmt.Println(d.Excerpt())
+		}
+		return false
+	}
+	report, err := hrm.CheckWith(level, program, config)
+	if _, ok := err.(*hrm.LevelError); ok {
+		fmt.Println(err)
+		return false
+	}
+	if config.Runs > 0 {
+		fmt.Printf("Seed: %d\n", config.Seed)
+	}
+	for i, run := range report.Runs {
+		if config.Runs > 0 {
+			fmt.Printf("Run %-3d ", i + 1)
+		}
+		if _, ok := run.Err.(*hrm.RuntimeError); !ok {
+			// Exhaustive cases each count steps from zero, so their total
+			// is not the steps of any run of the game
+			if config.Runs > 0 {
+				fmt.Printf("Steps: %-4d Size: %-4d\n", run.Steps, report.Size)
+			} else {
+				fmt.Printf("Cases: %-4d Size: %-4d\n", run.Cases, report.Size)
+			}
+		}
+		if _, ok := run.Err.(*hrm.OutboxError); ok || run.Err == nil {
+			fmt.Printf("Expecting INBOX (%d values) -> OUTBOX (%d values)...\n",
+				run.InboxValues, run.ExpectedValues)
+		}
+		for _, failure := range run.Failures {
+			fmt.Printf("Case %d failed with INBOX %v\n", failure.Case + 1, failure.Inbox)
+			fmt.Println(failure.Err)
+		}
+	}
+	if err != nil {
+		return false
+	}
+	if config.Runs > 0 {
+		fmt.Printf("Average Steps: %-6.1f Size: %-4d\n", report.AverageSteps(), report.Size)
+	}
+	reportSize(report.SizeGoal, report.Size)
+	if config.Runs > 0 {
+		reportSpeed(report.SpeedGoal, report.AverageSteps())
+	}
+	fmt.Printf("Level %d test passed.\n", level)
+	return true
+}
+
+/* Reports whether the program meets the level's size challenge. */
+func reportSize(goal int, size int) {
+	if goal == 0 {
+		return
+	}
+	fmt.Printf("Size Challenge:  %-4d ", goal)
+	if diff := goal - size; diff == 0 {
+		fmt.Printf("met exactly.\n")
+	} else if diff > 0 {
+		fmt.Printf("met, beaten by %d instructions.\n", diff)
+	} else {
+		fmt.Printf("missed by %d instructions.\n", -diff)
+	}
+}
+
+/* Reports whether the average steps meet the level's speed challenge.
+Only random runs are comparable, since the exhaustive inputs are far
+longer than the game's inboxes. */
+func reportSpeed(goal int, steps float64) {
+	if goal == 0 {
+		return
+	}
+	fmt.Printf("Speed Challenge: %-4d ", goal)
+	if diff := float64(goal) - steps; diff == 0 {
+		fmt.Printf("met exactly.\n")
+	} else if diff > 0 {
+		fmt.Printf("met, beaten by %.1f steps.\n", diff)
+	} else {
+		fmt.Printf("missed by %.1f steps.\n", -diff)
+	}
 }